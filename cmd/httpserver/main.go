@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,101 +13,136 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"http-protocol-go/internal/negotiate"
 	"http-protocol-go/internal/request"
 	"http-protocol-go/internal/response"
+	"http-protocol-go/internal/router"
 	"http-protocol-go/internal/server"
 )
 
 const port = 42069
+const tlsPort = 42070
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	server, err := server.Serve(port, func(w *response.Writer, req *request.Request) {
-		if strings.HasPrefix(req.RequestLine.Target, "/httpbin") {
-			proxy(w, req)
-			return
+	mux := router.NewServeMux()
+	mux.Handle("", "/httpbin/{path...}", proxy)
+	mux.Handle("", "/video", responseVideo)
+	mux.Handle("", "/yourproblem", response400)
+	mux.Handle("", "/myproblem", response500)
+	mux.Handle("", "/{path...}", response200)
+
+	handler := server.Chain(mux.Serve, server.Recover, server.Compress(server.CompressOptions{}))
+
+	servers := []*server.Server{{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: handler,
+		Logger:  log.Default(),
+	}}
+
+	// HTTPS is served next to plain HTTP when a certificate is configured,
+	// SIGHUP reloads it from disk
+	var certs *server.CertStore
+	if certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"); certFile != "" && keyFile != "" {
+		var err error
+		certs, err = server.LoadCertStore(server.CertFiles{CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			log.Fatalf("Error loading certificate: %v", err)
 		}
-		switch req.RequestLine.Target {
-		case "/video":
-			responseVideo(w)
-		case "/yourproblem":
-			response400(w)
-		case "/myproblem":
-			response500(w)
-		default:
-			response200(w)
-		}
-	})
 
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		servers = append(servers, &server.Server{
+			Addr:      fmt.Sprintf(":%d", tlsPort),
+			Handler:   handler,
+			Logger:    log.Default(),
+			TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+		})
+	}
+
+	for _, srv := range servers {
+		go func() {
+			if err := srv.ListenAndServe(); !errors.Is(err, server.ErrServerClosed) {
+				log.Fatalf("Error starting server: %v", err)
+			}
+		}()
+		log.Println("Server started on", srv.Addr)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if certs == nil {
+			continue
+		}
+		if err := certs.Reload(); err != nil {
+			log.Printf("Error reloading certificate: %v", err)
+			continue
+		}
+		log.Println("Certificate reloaded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Server on %s did not drain in time: %v", srv.Addr, err)
+			srv.Close()
+		}
+	}
 	log.Println("Server gracefully stopped")
 }
 
-func response400(w *response.Writer) {
-	w.WriteStatusLine(response.BAD_REQUEST)
-
-	body := `<html>
-	<head>
-		<title>400 Bad Request</title>
-	</head>
-	<body>
-		<h1>Bad Request</h1>
-		<p>Your request honestly kinda sucked.</p>
-	</body>
+// pageTypes are the representations the demo pages are available in.
+var pageTypes = []string{"text/html", "text/plain"}
+
+const htmlPage = `<html>
+  <head>
+    <title>%d %s</title>
+  </head>
+  <body>
+    <h1>%s</h1>
+    <p>%s</p>
+  </body>
 </html>`
 
-	h := response.GetDefaultHeaders(len(body))
-	h.Set("Content-Type", "text/html")
-	w.WriteHeaders(h)
+// writePage answers with a short page in whichever of pageTypes the client
+// prefers, or 406 if it accepts neither.
+func writePage(w *response.Writer, req *request.Request, statusCode response.StatusCode, heading string, message string) {
+	contentType, ok := negotiate.ContentType(req.Headers, pageTypes)
+	if !ok {
+		negotiate.NotAcceptable(w, pageTypes)
+		return
+	}
 
-	w.WriteBody([]byte(body))
-}
+	body := fmt.Sprintf("%s\n%s\n", heading, message)
+	if contentType == "text/html" {
+		body = fmt.Sprintf(htmlPage, statusCode, response.StatusText(statusCode), heading, message)
+	}
 
-func response500(w *response.Writer) {
-	w.WriteStatusLine(response.INTERNAL_SERVER_ERROR)
-	body := `<html>
-	<head>
-		<title>500 Internal Server Error</title>
-	</head>
-	<body>
-		<h1>Internal Server Error</h1>
-		<p>Okay, you know what? This one is on me.</p>
-	</body>
-</html>`
+	w.WriteStatusLine(statusCode)
 
 	h := response.GetDefaultHeaders(len(body))
-	h.Set("Content-Type", "text/html")
+	h.Set("Content-Type", contentType)
+	negotiate.Vary(h, "Accept")
 	w.WriteHeaders(h)
 
 	w.WriteBody([]byte(body))
 }
 
-func response200(w *response.Writer) {
-	w.WriteStatusLine(response.OK)
-
-	body := `<html>
-  <head>
-    <title>200 OK</title>
-  </head>
-  <body>
-    <h1>Success!</h1>
-    <p>Your request was an absolute banger.</p>
-  </body>
-</html>`
+func response400(w *response.Writer, req *request.Request) {
+	writePage(w, req, response.BAD_REQUEST, "Bad Request", "Your request honestly kinda sucked.")
+}
 
-	h := response.GetDefaultHeaders(len(body))
-	h.Set("Content-Type", "text/html")
-	w.WriteHeaders(h)
+func response500(w *response.Writer, req *request.Request) {
+	writePage(w, req, response.INTERNAL_SERVER_ERROR, "Internal Server Error", "Okay, you know what? This one is on me.")
+}
 
-	w.WriteBody([]byte(body))
+func response200(w *response.Writer, req *request.Request) {
+	writePage(w, req, response.OK, "Success!", "Your request was an absolute banger.")
 }
 
 func proxy(w *response.Writer, req *request.Request) {
@@ -114,15 +152,16 @@ func proxy(w *response.Writer, req *request.Request) {
 	resp, err := http.Get(url)
 	if err != nil {
 		log.Printf("Error while proxying request: %v", err)
-		response500(w)
+		response500(w, req)
 		return
 	}
 	defer resp.Body.Close()
 
 	newHeaders := response.GetDefaultHeaders(0)
+	newHeaders.Del("Content-Type")
 	for key, values := range resp.Header {
 		for _, value := range values {
-			newHeaders.Set(key, value)
+			newHeaders.Add(key, value)
 		}
 	}
 
@@ -138,7 +177,7 @@ func proxy(w *response.Writer, req *request.Request) {
 	for {
 		n, err := resp.Body.Read(buf)
 		if err != nil && err != io.EOF {
-			response500(w)
+			response500(w, req)
 			break
 		}
 
@@ -147,7 +186,7 @@ func proxy(w *response.Writer, req *request.Request) {
 		}
 
 		if _, err = w.WriteChunkedBody(buf[:n]); err != nil {
-			response500(w)
+			response500(w, req)
 			break
 		}
 
@@ -156,7 +195,7 @@ func proxy(w *response.Writer, req *request.Request) {
 
 	_, err = w.WriteChunkedBodyDone()
 	if err != nil {
-		response500(w)
+		response500(w, req)
 		return
 	}
 
@@ -167,19 +206,20 @@ func proxy(w *response.Writer, req *request.Request) {
 
 	err = w.WriteTrailers(trailers)
 	if err != nil {
-		response500(w)
+		response500(w, req)
 		return
 	}
 }
 
-func responseVideo(w *response.Writer) {
-	w.WriteStatusLine(response.OK)
+func responseVideo(w *response.Writer, req *request.Request) {
 	data, err := os.ReadFile("./assets/vim.mp4")
 	if err != nil {
-		response500(w)
+		response500(w, req)
 		return
 	}
 
+	w.WriteStatusLine(response.OK)
+
 	h := response.GetDefaultHeaders(len(data))
 	h.Set("Content-Type", "video/mp4")
 	w.WriteHeaders(h)
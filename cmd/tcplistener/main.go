@@ -32,12 +32,15 @@ func main() {
 		fmt.Printf("- Version: %s\n", result.RequestLine.HttpVersion)
 
 		fmt.Println("Headers:")
-		for key, value := range result.Headers {
+		for key, value := range result.Headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
 
+		body, err := result.ReadBody()
+		assert.NoError(err, "reading body failed")
+
 		fmt.Println("Body:")
-		fmt.Println(string(result.Body))
+		fmt.Println(string(body))
 
 		conn.Close()
 		// fmt.Println("[-] connection closed")
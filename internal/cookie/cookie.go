@@ -0,0 +1,173 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"http-protocol-go/internal/headers"
+)
+
+// TimeFormat is the date format of the Expires attribute, the IMF-fixdate of
+// RFC 9110.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out, letting the browser decide.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+func (s SameSite) String() string {
+	switch s {
+	case SameSiteLax:
+		return "Lax"
+	case SameSiteStrict:
+		return "Strict"
+	case SameSiteNone:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+// Cookie is a cookie sent by a client in a Cookie header, where only Name and
+// Value are set, or by the server in a Set-Cookie header.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero leaves the attribute out, a
+	// negative value deletes the cookie right away with Max-Age=0.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse returns the cookies of all Cookie headers in h, in the order they were
+// sent. Malformed pairs are skipped, as browsers send whatever they stored.
+func Parse(h *headers.Headers) []*Cookie {
+	var cookies []*Cookie
+	for _, line := range h.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			name, value, found := strings.Cut(strings.Trim(pair, " \t"), "=")
+			if !found || !headers.IsToken(name) {
+				continue
+			}
+			value, ok := parseValue(value)
+			if !ok {
+				continue
+			}
+			cookies = append(cookies, &Cookie{Name: name, Value: value})
+		}
+	}
+	return cookies
+}
+
+// parseValue strips the optional quotes around a cookie value and checks
+// that it only holds cookie-octets.
+func parseValue(value string) (string, bool) {
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// isCookieOctet reports whether c may appear in a cookie value: printable
+// US-ASCII except whitespace, double quote, comma, semicolon and backslash.
+func isCookieOctet(c byte) bool {
+	return c > ' ' && c < 0x7f && c != '"' && c != ',' && c != ';' && c != '\\'
+}
+
+// Valid reports why c cannot be sent in a Set-Cookie header, if at all.
+func (c *Cookie) Valid() error {
+	if !headers.IsToken(c.Name) {
+		return fmt.Errorf("invalid cookie name %q", c.Name)
+	}
+	if _, ok := parseValue(c.Value); !ok {
+		return fmt.Errorf("invalid value for cookie %s", c.Name)
+	}
+	if !validAttribute(c.Path) {
+		return fmt.Errorf("invalid path for cookie %s", c.Name)
+	}
+	if !validAttribute(c.Domain) || strings.ContainsAny(c.Domain, " \t") {
+		return fmt.Errorf("invalid domain for cookie %s", c.Name)
+	}
+	if c.SameSite < SameSiteDefault || c.SameSite > SameSiteNone {
+		return fmt.Errorf("invalid SameSite for cookie %s", c.Name)
+	}
+	// browsers drop these unless the cookie is restricted to HTTPS
+	if (c.SameSite == SameSiteNone || c.Partitioned) && !c.Secure {
+		return errors.New("SameSite=None and Partitioned cookies must be Secure")
+	}
+	return nil
+}
+
+// validAttribute reports whether v can be an attribute value: any character
+// but controls and the semicolon that separates attributes.
+func validAttribute(v string) bool {
+	return !strings.ContainsFunc(v, func(c rune) bool { return c < ' ' || c == 0x7f || c == ';' })
+}
+
+// String returns the Set-Cookie value for c. It does not check c, use Valid
+// for that.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteString("=")
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != SameSiteDefault {
+		b.WriteString("; SameSite=" + c.SameSite.String())
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// SetCookie adds c to h as a Set-Cookie header line of its own, since
+// Set-Cookie values cannot be combined into one line.
+func SetCookie(h *headers.Headers, c *Cookie) error {
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	h.Add("Set-Cookie", c.String())
+	return nil
+}
@@ -0,0 +1,88 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/headers"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Pairs from every Cookie line in order
+	h := headers.NewHeaders()
+	h.Add("Cookie", `session=abc123; theme="dark"; empty=`)
+	h.Add("cookie", "lang=en")
+	cookies := Parse(h)
+	require.Len(t, cookies, 4)
+	assert.Equal(t, &Cookie{Name: "session", Value: "abc123"}, cookies[0])
+	assert.Equal(t, &Cookie{Name: "theme", Value: "dark"}, cookies[1])
+	assert.Equal(t, &Cookie{Name: "empty", Value: ""}, cookies[2])
+	assert.Equal(t, &Cookie{Name: "lang", Value: "en"}, cookies[3])
+
+	// Test: Malformed pairs are skipped
+	h = headers.NewHeaders()
+	h.Add("Cookie", `noequals; bad name=1; quote=a"b; comma=a,b; ok=1;;`)
+	cookies = Parse(h)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+
+	// Test: No Cookie header
+	assert.Empty(t, Parse(headers.NewHeaders()))
+}
+
+func TestString(t *testing.T) {
+	// Test: All attributes
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2030, time.January, 2, 15, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "session=abc123; Path=/; Domain=example.com; Expires=Wed, 02 Jan 2030 14:04:05 GMT; "+
+		"Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Only name and value
+	assert.Equal(t, "a=1", (&Cookie{Name: "a", Value: "1"}).String())
+
+	// Test: Deleting a cookie
+	assert.Equal(t, "a=; Max-Age=0; SameSite=Strict", (&Cookie{Name: "a", MaxAge: -1, SameSite: SameSiteStrict}).String())
+}
+
+func TestValid(t *testing.T) {
+	for _, c := range []*Cookie{
+		{Name: "", Value: "1"},
+		{Name: "a b", Value: "1"},
+		{Name: "a", Value: "1;admin=1"},
+		{Name: "a", Value: "hello world"},
+		{Name: "a", Value: "1\r\nSet-Cookie: admin=1"},
+		{Name: "a", Value: "1", Path: "/; Domain=evil.com"},
+		{Name: "a", Value: "1", Domain: "example.com\n"},
+		{Name: "a", Value: "1", SameSite: SameSiteNone},
+		{Name: "a", Value: "1", Partitioned: true},
+		{Name: "a", Value: "1", SameSite: 7},
+	} {
+		assert.Error(t, c.Valid(), "%+v", c)
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: Every cookie gets its own header line
+	h := headers.NewHeaders()
+	require.NoError(t, SetCookie(h, &Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, SetCookie(h, &Cookie{Name: "b", Value: "2", SameSite: SameSiteLax}))
+	assert.Equal(t, []string{"a=1; HttpOnly", "b=2; SameSite=Lax"}, h.Values("Set-Cookie"))
+
+	// Test: Invalid cookie is not added
+	require.Error(t, SetCookie(h, &Cookie{Name: "c", Value: "x;y"}))
+	assert.Equal(t, 2, h.Len())
+}
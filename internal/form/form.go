@@ -0,0 +1,294 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"http-protocol-go/internal/headers"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("body is not a form")
+	ErrTooLarge             = errors.New("form too large")
+)
+
+// Limits bounds the size of a form. A zero field means no limit.
+type Limits struct {
+	// MaxMemory bounds the bytes of a form kept in memory. URL-encoded bodies
+	// and multipart field values larger than that are rejected, multipart
+	// file parts that do not fit are spooled to temporary files instead.
+	MaxMemory int64
+	// MaxFieldBytes bounds the value of a single field that is not a file.
+	MaxFieldBytes int64
+	// MaxFileBytes bounds a single file.
+	MaxFileBytes int64
+	// MaxParts bounds the number of fields and files.
+	MaxParts int
+}
+
+var DefaultLimits = Limits{
+	MaxMemory:     10 << 20,
+	MaxFieldBytes: 1 << 20,
+	MaxParts:      1000,
+}
+
+// Form is a decoded form body.
+type Form struct {
+	Values url.Values
+	Files  map[string][]*File
+}
+
+// File is an uploaded file of a multipart form, held in memory or in a
+// temporary file depending on its size.
+type File struct {
+	Filename string
+	Header   *headers.Headers
+	Size     int64
+
+	content []byte
+	path    string
+}
+
+// Open returns the content of the file.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.path == "" {
+		return io.NopCloser(bytes.NewReader(f.content)), nil
+	}
+	return os.Open(f.path)
+}
+
+// OnDisk reports whether the file was spooled to a temporary file.
+func (f *File) OnDisk() bool {
+	return f.path != ""
+}
+
+// RemoveAll deletes the temporary files of the form. It has to be called once
+// the files are no longer needed.
+func (f *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.path != "" {
+				errs = append(errs, os.Remove(file.path))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Parse decodes body according to contentType, which has to be
+// application/x-www-form-urlencoded or multipart/form-data.
+func Parse(body io.Reader, contentType string, limits Limits) (*Form, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := ParseURLEncoded(body, limits)
+		if err != nil {
+			return nil, err
+		}
+		return &Form{Values: values, Files: map[string][]*File{}}, nil
+
+	case "multipart/form-data":
+		return ParseMultipart(body, contentType, limits)
+
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+}
+
+// ParseURLEncoded decodes an application/x-www-form-urlencoded body.
+// Malformed pairs are skipped, like Request.Query does for query strings.
+func ParseURLEncoded(body io.Reader, limits Limits) (url.Values, error) {
+	data, err := readLimited(body, limits.MaxMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	// every pair counts, including repeated names and malformed ones
+	if limits.MaxParts > 0 {
+		pairs := 0
+		for _, pair := range strings.Split(string(data), "&") {
+			if pair != "" {
+				pairs++
+			}
+		}
+		if pairs > limits.MaxParts {
+			return nil, ErrTooLarge
+		}
+	}
+
+	values, _ := url.ParseQuery(string(data))
+	if limits.MaxFieldBytes > 0 {
+		for _, vs := range values {
+			for _, v := range vs {
+				if int64(len(v)) > limits.MaxFieldBytes {
+					return nil, ErrTooLarge
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// NewMultipartReader returns a reader for the parts of a multipart/form-data
+// body, for handlers that stream uploads instead of parsing the whole form.
+func NewMultipartReader(body io.Reader, contentType string) (*multipart.Reader, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrUnsupportedMediaType
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, errors.New("multipart boundary missing")
+	}
+	return multipart.NewReader(body, boundary), nil
+}
+
+// ParseMultipart decodes a multipart/form-data body. Field values and files
+// are kept in memory while they fit into limits.MaxMemory together. Files
+// beyond that are spooled to temporary files, while fields beyond that fail
+// with ErrTooLarge. On error, temporary files already written are removed.
+func ParseMultipart(body io.Reader, contentType string, limits Limits) (form *Form, err error) {
+	mr, err := NewMultipartReader(body, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	form = &Form{Values: url.Values{}, Files: map[string][]*File{}}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+			form = nil
+		}
+	}()
+
+	memoryLeft := limits.MaxMemory
+	parts := 0
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return form, err
+		}
+
+		parts++
+		if limits.MaxParts > 0 && parts > limits.MaxParts {
+			return form, ErrTooLarge
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+			value, err := readLimited(part, limits.MaxFieldBytes)
+			if err != nil {
+				return form, err
+			}
+			// fields cannot be spooled, they have to fit into memory
+			if limits.MaxMemory > 0 {
+				memoryLeft -= int64(len(value))
+				if memoryLeft < 0 {
+					return form, ErrTooLarge
+				}
+			}
+			form.Values.Add(name, string(value))
+			continue
+		}
+
+		file, err := readFile(part, &memoryLeft, limits)
+		if file != nil {
+			form.Files[name] = append(form.Files[name], file)
+		}
+		if err != nil {
+			return form, err
+		}
+	}
+}
+
+// readFile reads a file part into memory, or into a temporary file once it
+// no longer fits into the memory left. A file is returned whenever a
+// temporary file was created, so that the caller can remove it.
+func readFile(part *multipart.Part, memoryLeft *int64, limits Limits) (*File, error) {
+	header := headers.NewHeaders()
+	for _, name := range slices.Sorted(maps.Keys(part.Header)) {
+		for _, value := range part.Header[name] {
+			header.Add(name, value)
+		}
+	}
+	file := &File{Filename: part.FileName(), Header: header}
+
+	var reader io.Reader = part
+	if limits.MaxFileBytes > 0 {
+		reader = io.LimitReader(part, limits.MaxFileBytes+1)
+	}
+
+	// with no memory limit everything stays in memory
+	var content []byte
+	var err error
+	if limits.MaxMemory <= 0 {
+		content, err = io.ReadAll(reader)
+	} else {
+		content, err = io.ReadAll(io.LimitReader(reader, *memoryLeft+1))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxMemory <= 0 || int64(len(content)) <= *memoryLeft {
+		*memoryLeft -= int64(len(content))
+		file.content = content
+		file.Size = int64(len(content))
+		if limits.MaxFileBytes > 0 && file.Size > limits.MaxFileBytes {
+			return nil, ErrTooLarge
+		}
+		return file, nil
+	}
+
+	tmp, err := os.CreateTemp("", "form-*")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+	file.path = tmp.Name()
+
+	n, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(content), reader))
+	file.Size = n
+	if err != nil {
+		return file, err
+	}
+	if limits.MaxFileBytes > 0 && file.Size > limits.MaxFileBytes {
+		return file, ErrTooLarge
+	}
+	return file, nil
+}
+
+// readLimited reads all of r, failing with ErrTooLarge past limit bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
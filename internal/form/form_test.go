@@ -0,0 +1,155 @@
+package form
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// multipartBody builds a multipart/form-data body with the given fields and
+// files, returning it with its content type.
+func multipartBody(t *testing.T, fields map[string]string, files map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	return buf, mw.FormDataContentType()
+}
+
+func fileContent(t *testing.T, f *File) string {
+	t.Helper()
+
+	r, err := f.Open()
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestParseURLEncoded(t *testing.T) {
+	// Test: Fields with repeated names and escapes
+	form, err := Parse(strings.NewReader("name=Caf%C3%A9+Bar&tag=a&tag=b"),
+		"application/x-www-form-urlencoded; charset=utf-8", DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "Café Bar", form.Values.Get("name"))
+	assert.Equal(t, []string{"a", "b"}, form.Values["tag"])
+	assert.Empty(t, form.Files)
+
+	// Test: Malformed pairs are skipped
+	form, err = Parse(strings.NewReader("name=%zz&a=1;b=2&c=3"), "application/x-www-form-urlencoded", DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"c": {"3"}}, form.Values)
+
+	// Test: Limits
+	_, err = Parse(strings.NewReader("name=toolong"), "application/x-www-form-urlencoded", Limits{MaxMemory: 8})
+	require.ErrorIs(t, err, ErrTooLarge)
+	_, err = Parse(strings.NewReader("name=toolong"), "application/x-www-form-urlencoded", Limits{MaxFieldBytes: 4})
+	require.ErrorIs(t, err, ErrTooLarge)
+	_, err = Parse(strings.NewReader("a=1&b=2&c=3"), "application/x-www-form-urlencoded", Limits{MaxParts: 2})
+	require.ErrorIs(t, err, ErrTooLarge)
+	_, err = Parse(strings.NewReader(strings.Repeat("a=1&", 5001)), "application/x-www-form-urlencoded", Limits{MaxParts: 10})
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// Test: Other media types
+	_, err = Parse(strings.NewReader("{}"), "application/json", DefaultLimits)
+	require.ErrorIs(t, err, ErrUnsupportedMediaType)
+	_, err = Parse(strings.NewReader("a=1"), "", DefaultLimits)
+	require.ErrorIs(t, err, ErrUnsupportedMediaType)
+}
+
+func TestParseMultipart(t *testing.T) {
+	// Test: Fields and files, small ones in memory, large ones on disk
+	body, contentType := multipartBody(t,
+		map[string]string{"title": "holiday"},
+		map[string]string{"small": "tiny", "large": strings.Repeat("x", 100)})
+	form, err := Parse(body, contentType, Limits{MaxMemory: 50})
+	require.NoError(t, err)
+	defer form.RemoveAll()
+
+	assert.Equal(t, "holiday", form.Values.Get("title"))
+
+	small := form.Files["small"][0]
+	assert.Equal(t, "small.txt", small.Filename)
+	assert.Equal(t, int64(4), small.Size)
+	assert.False(t, small.OnDisk())
+	assert.Equal(t, "tiny", fileContent(t, small))
+	contentType, ok := small.Header.Get("Content-Type")
+	assert.True(t, ok)
+	assert.Equal(t, "application/octet-stream", contentType)
+
+	large := form.Files["large"][0]
+	assert.Equal(t, int64(100), large.Size)
+	assert.True(t, large.OnDisk())
+	assert.Equal(t, strings.Repeat("x", 100), fileContent(t, large))
+
+	// Test: RemoveAll deletes the temporary files
+	require.NoError(t, form.RemoveAll())
+	_, err = os.Stat(large.path)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Field over the limit
+	body, contentType = multipartBody(t, map[string]string{"title": "holiday"}, nil)
+	_, err = Parse(body, contentType, Limits{MaxFieldBytes: 4})
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// Test: Fields over the memory limit together
+	body, contentType = multipartBody(t, map[string]string{"a": "12345", "b": "67890"}, nil)
+	_, err = Parse(body, contentType, Limits{MaxMemory: 8, MaxFieldBytes: 6})
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// Test: File over the limit, including spooled ones
+	for _, limits := range []Limits{{MaxFileBytes: 10}, {MaxFileBytes: 10, MaxMemory: 5}} {
+		body, contentType = multipartBody(t, nil, map[string]string{"large": strings.Repeat("x", 100)})
+		_, err = Parse(body, contentType, limits)
+		require.ErrorIs(t, err, ErrTooLarge)
+	}
+
+	// Test: Too many parts
+	body, contentType = multipartBody(t, map[string]string{"a": "1", "b": "2"}, nil)
+	_, err = Parse(body, contentType, Limits{MaxParts: 1})
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// Test: Missing boundary and truncated body
+	_, err = Parse(strings.NewReader(""), "multipart/form-data", DefaultLimits)
+	require.Error(t, err)
+	body, contentType = multipartBody(t, map[string]string{"a": "1"}, nil)
+	_, err = Parse(bytes.NewReader(body.Bytes()[:body.Len()-10]), contentType, DefaultLimits)
+	require.Error(t, err)
+}
+
+func TestNewMultipartReader(t *testing.T) {
+	body, contentType := multipartBody(t, nil, map[string]string{"upload": "streamed"})
+	mr, err := NewMultipartReader(body, contentType)
+	require.NoError(t, err)
+
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "upload", part.FormName())
+	data, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "streamed", string(data))
+
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = NewMultipartReader(body, "application/x-www-form-urlencoded")
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+}
@@ -4,15 +4,29 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"iter"
+	"slices"
 	"strings"
 )
 
 const crlf = "\r\n"
 
-type Headers map[string]string
+// Headers is an ordered list of header fields. A field may appear several
+// times and keeps the name casing it was added with, while lookups ignore
+// case. The zero value is an empty list ready to use, and a nil *Headers can
+// be read like an empty one.
+type Headers struct {
+	fields []Field
+}
+
+// Field is a single header line.
+type Field struct {
+	Name  string
+	Value string
+}
 
-func NewHeaders() Headers {
-	return Headers{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 // Uppercase letters: A-Z
@@ -22,10 +36,67 @@ func NewHeaders() Headers {
 
 const validHeaderChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&'*+-.^_`|~"
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+// IsToken reports whether s is a non-empty token, the syntax shared by field
+// names, methods and many field values.
+func IsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(validHeaderChars, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxValueLength bounds the length of a single field value, both when parsing
+// and when validating fields for writing.
+const MaxValueLength = 64 << 10
+
+// ErrValueTooLong is returned for a field value longer than MaxValueLength.
+var ErrValueTooLong = errors.New("header value too long")
+
+// ValidateField checks that name is a token and value a valid field value:
+// no longer than MaxValueLength and free of control characters other than
+// tabs, so that it cannot end the header line early or smuggle in another
+// one. Leading or trailing whitespace is not allowed either, since it would
+// not survive parsing.
+func ValidateField(name string, value string) error {
+	if !IsToken(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if len(value) > MaxValueLength {
+		return fmt.Errorf("%w: %s", ErrValueTooLong, name)
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c != '\t' && (c < ' ' || c == 0x7f) {
+			return fmt.Errorf("invalid character %q in value of header %s", c, name)
+		}
+	}
+	if strings.Trim(value, " \t") != value {
+		return fmt.Errorf("value of header %s has surrounding whitespace", name)
+	}
+	return nil
+}
+
+// Validate checks every field with ValidateField and returns the first error.
+func (h *Headers) Validate() error {
+	for name, value := range h.All() {
+		if err := ValidateField(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	eol := bytes.Index(data, []byte(crlf))
 
 	if eol < 0 {
+		if bytes.IndexByte(data, '\n') >= 0 {
+			return 0, false, errors.New("bare LF in header line")
+		}
 		return 0, false, nil
 	}
 
@@ -33,42 +104,129 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 2, true, nil
 	}
 
-	parts := bytes.SplitN(data[:eol], []byte(":"), 2)
+	line := data[:eol]
+	// a bare CR or LF would end the line for some parsers but not for others
+	if bytes.ContainsAny(line, "\r\n") {
+		return 0, false, errors.New("bare CR or LF in header line")
+	}
+	// leading whitespace is either an obsolete line folding or hides the
+	// field from parsers that skip it
+	if line[0] == ' ' || line[0] == '\t' {
+		return 0, false, errors.New("header line starts with whitespace")
+	}
 
-	key := string(parts[0])
-	if key != strings.TrimRight(key, " ") {
+	key, value, found := bytes.Cut(line, []byte(":"))
+	if !found {
+		return 0, false, errors.New("header line without colon")
+	}
+	name := string(key)
+	if !IsToken(name) {
 		return 0, false, errors.New("invalid header key")
 	}
+	fieldValue := string(bytes.Trim(value, " \t"))
+	if err := ValidateField(name, fieldValue); err != nil {
+		return 0, false, err
+	}
 
-	key = strings.TrimSpace(key)
-	value := string(bytes.TrimSpace(parts[1]))
+	h.Add(name, fieldValue)
+	return eol + 2, false, nil
+}
 
-	key = strings.ToLower(key)
-	for _, c := range key {
-		if !strings.ContainsRune(validHeaderChars, c) {
-			return 0, false, errors.New("invalid character in header key")
+// Len returns the number of fields, counting repeated ones separately.
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// Add appends a field, keeping any existing ones with the same name.
+func (h *Headers) Add(name string, value string) {
+	h.fields = append(h.fields, Field{Name: name, Value: value})
+}
+
+// Get returns the values of the field combined into one comma-separated list,
+// the way RFC 9110 allows list-based fields to be joined, and whether the
+// field is present at all. Fields that cannot be combined, like Set-Cookie,
+// have to be read with Values.
+func (h *Headers) Get(name string) (string, bool) {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, ", "), true
+}
+
+// Values returns all values of the field in the order they were added.
+func (h *Headers) Values(name string) []string {
+	if h == nil {
+		return nil
+	}
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.Name, name) {
+			values = append(values, f.Value)
 		}
 	}
+	return values
+}
+
+// Set replaces all values of the field with value, keeping the position of
+// the first one. The field is appended if it is not present yet.
+func (h *Headers) Set(name string, value string) {
+	matches := func(f Field) bool { return strings.EqualFold(f.Name, name) }
 
-	if header, exists := h[key]; exists {
-		h[key] = fmt.Sprintf("%s, %s", header, value)
-	} else {
-		h[key] = value
+	i := slices.IndexFunc(h.fields, matches)
+	if i < 0 {
+		h.Add(name, value)
+		return
 	}
-	return eol + 2, false, nil
+	h.fields[i] = Field{Name: name, Value: value}
+	rest := slices.DeleteFunc(h.fields[i+1:], matches)
+	h.fields = h.fields[:i+1+len(rest)]
+}
+
+// Del removes all values of the field.
+func (h *Headers) Del(name string) {
+	h.fields = slices.DeleteFunc(h.fields, func(f Field) bool { return strings.EqualFold(f.Name, name) })
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	value, ok := h[strings.ToLower(key)]
-	return value, ok
+// All iterates over the fields in order, yielding repeated fields once per
+// value.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if !yield(f.Name, f.Value) {
+				return
+			}
+		}
+	}
 }
 
-func (h Headers) Set(key string, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+// Clone returns a copy of h that can be changed independently.
+func (h *Headers) Clone() *Headers {
+	if h == nil {
+		return NewHeaders()
+	}
+	return &Headers{fields: slices.Clone(h.fields)}
 }
 
-func (h Headers) Del(key string) {
-	key = strings.ToLower(key)
-	delete(h, key)
+// CanonicalName returns name with the first letter and every letter after a
+// hyphen in upper case and all others in lower case, as in "Content-Type".
+func CanonicalName(name string) string {
+	b := []byte(name)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case !upper && 'A' <= c && c <= 'Z':
+			b[i] = c - 'A' + 'a'
+		}
+		upper = c == '-'
+	}
+	return string(b)
 }
@@ -1,6 +1,7 @@
 package headers
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,18 +15,26 @@ func TestRequestLineParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid single header with extra spaces
 	headers = NewHeaders()
-	data = []byte("     Host: localhost:42069     \r\n\r\n")
+	data = []byte("Host: \t localhost:42069     \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, 33, n)
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, 30, n)
+	assert.False(t, done)
+
+	// Test: Leading whitespace before the header name
+	headers = NewHeaders()
+	data = []byte("     Host: localhost:42069     \r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
@@ -36,7 +45,10 @@ func TestRequestLineParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069, localhost:12345", headers["host"])
+	assert.Equal(t, []string{"localhost:42069", "localhost:12345"}, headers.Values("host"))
+	value, ok := headers.Get("Host")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:42069, localhost:12345", value)
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -53,4 +65,147 @@ func TestRequestLineParse(t *testing.T) {
 	data = []byte("H©st: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
+
+	// Test: Obsolete line folding
+	headers = NewHeaders()
+	data = []byte("X-Folded: one\r\n two\r\n\r\n")
+	n, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.Error(t, err)
+
+	// Test: Bare LF and CR
+	for _, data := range []string{
+		"Host: localhost:42069\nX-Smuggled: yes\r\n\r\n",
+		"Host: localhost:42069\n\n",
+		"Host: localhost:42069\rX-Smuggled: yes\r\n\r\n",
+	} {
+		headers = NewHeaders()
+		_, _, err = headers.Parse([]byte(data))
+		require.Error(t, err, "%q", data)
+	}
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	data = []byte("Host\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.Error(t, err)
+}
+
+func TestHeaders(t *testing.T) {
+	h := NewHeaders()
+	h.Add("content-type", "text/plain")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("X-Request-ID", "42")
+	h.Add("set-cookie", "b=2; Path=/")
+
+	// Test: Values are kept per line and in order
+	assert.Equal(t, 4, h.Len())
+	assert.Equal(t, []string{"a=1", "b=2; Path=/"}, h.Values("SET-COOKIE"))
+	assert.Nil(t, h.Values("Accept"))
+	_, ok := h.Get("Accept")
+	assert.False(t, ok)
+
+	// Test: Iteration keeps insertion order and casing
+	var fields []Field
+	for name, value := range h.All() {
+		fields = append(fields, Field{name, value})
+	}
+	assert.Equal(t, []Field{
+		{"content-type", "text/plain"},
+		{"Set-Cookie", "a=1"},
+		{"X-Request-ID", "42"},
+		{"set-cookie", "b=2; Path=/"},
+	}, fields)
+
+	// Test: Set replaces all values in place of the first
+	clone := h.Clone()
+	h.Set("Set-Cookie", "c=3")
+	assert.Equal(t, []string{"c=3"}, h.Values("set-cookie"))
+	fields = nil
+	for name, value := range h.All() {
+		fields = append(fields, Field{name, value})
+	}
+	assert.Equal(t, []Field{
+		{"content-type", "text/plain"},
+		{"Set-Cookie", "c=3"},
+		{"X-Request-ID", "42"},
+	}, fields)
+	assert.Equal(t, 4, clone.Len())
+
+	// Test: Set appends a new field
+	h.Set("Accept", "*/*")
+	value, ok := h.Get("accept")
+	assert.True(t, ok)
+	assert.Equal(t, "*/*", value)
+
+	// Test: Del removes every value
+	clone.Del("set-cookie")
+	assert.Equal(t, 2, clone.Len())
+	assert.Nil(t, clone.Values("Set-Cookie"))
+
+	// Test: Zero value is usable
+	var empty Headers
+	empty.Add("Host", "localhost")
+	assert.Equal(t, 1, empty.Len())
+
+	// Test: Nil headers read as empty
+	var none *Headers
+	assert.Equal(t, 0, none.Len())
+	_, ok = none.Get("Host")
+	assert.False(t, ok)
+	for range none.All() {
+		t.Fatal("nil headers yielded a field")
+	}
+}
+
+func TestCanonicalName(t *testing.T) {
+	for name, want := range map[string]string{
+		"content-type":     "Content-Type",
+		"X-REQUEST-ID":     "X-Request-Id",
+		"www-authenticate": "Www-Authenticate",
+		"host":             "Host",
+		"x--y":             "X--Y",
+		"x_y":              "X_y",
+	} {
+		assert.Equal(t, want, CanonicalName(name))
+	}
+}
+
+func TestValidateField(t *testing.T) {
+	// Test: Valid fields
+	for _, value := range []string{"", "text/html; charset=utf-8", "a\tb", "caf\xc3\xa9"} {
+		assert.NoError(t, ValidateField("X-Value", value), "%q", value)
+	}
+
+	// Test: Invalid fields
+	for _, c := range []struct{ name, value string }{
+		{"X-Value", "a\r\nSet-Cookie: admin=1"},
+		{"X-Value", "a\nb"},
+		{"X-Value", "a\rb"},
+		{"X-Value", "a\x00b"},
+		{"X-Value", "a\x7fb"},
+		{"X-Value", " padded"},
+		{"X-Value", strings.Repeat("a", MaxValueLength+1)},
+		{"X Value", "a"},
+		{"X-Value:", "a"},
+		{"", "a"},
+	} {
+		assert.Error(t, ValidateField(c.name, c.value), "%q: %q", c.name, c.value)
+	}
+
+	// Test: Overlong value is reported as such
+	require.ErrorIs(t, ValidateField("X-Value", strings.Repeat("a", MaxValueLength+1)), ErrValueTooLong)
+
+	// Test: Control characters are rejected when parsing
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Value: a\x00b\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Validate reports the first invalid field
+	headers = NewHeaders()
+	headers.Add("Host", "localhost")
+	require.NoError(t, headers.Validate())
+	headers.Add("Location", "/next\r\n\r\n<script>")
+	require.Error(t, headers.Validate())
 }
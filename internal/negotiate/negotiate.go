@@ -0,0 +1,216 @@
+package negotiate
+
+import (
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/response"
+)
+
+// Spec is one element of an Accept-style header: a value, possibly a
+// wildcard, with its quality and any other parameters.
+type Spec struct {
+	Value  string
+	Q      float64
+	Params map[string]string
+}
+
+// ParseAccept parses the elements of an Accept, Accept-Language or
+// Accept-Encoding value in the order they were sent. Elements with a malformed
+// quality are skipped.
+func ParseAccept(value string) []Spec {
+	var specs []Spec
+	for _, element := range strings.Split(value, ",") {
+		parts := strings.Split(element, ";")
+		spec := Spec{Value: strings.ToLower(strings.Trim(parts[0], " \t")), Q: 1}
+		if spec.Value == "" {
+			continue
+		}
+
+		valid := true
+		for _, param := range parts[1:] {
+			name, value, _ := strings.Cut(strings.Trim(param, " \t"), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			if name != "q" {
+				if spec.Params == nil {
+					spec.Params = map[string]string{}
+				}
+				spec.Params[name] = value
+				continue
+			}
+			q, ok := parseQuality(value)
+			if !ok {
+				valid = false
+				break
+			}
+			spec.Q = q
+		}
+		if valid {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// parseQuality parses a qvalue: 0 or 1 with up to three decimals.
+func parseQuality(value string) (float64, bool) {
+	if value == "" || len(value) > 5 || value[0] != '0' && value[0] != '1' {
+		return 0, false
+	}
+	q, err := strconv.ParseFloat(value, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0, false
+	}
+	return q, true
+}
+
+// match is how well a spec matches an offer: the quality of the most
+// specific spec that matches it.
+type match struct {
+	q           float64
+	specificity int
+}
+
+// best picks the offer with the highest quality, breaking ties by the order
+// of offers. Offers that are only matched with q=0 are never picked. matches
+// returns the specificity of spec for offer, or -1 if it does not match.
+func best(specs []Spec, offers []string, matches func(spec Spec, offer string) int) (string, bool) {
+	bestOffer, bestQ := "", 0.0
+	for _, offer := range offers {
+		m := match{specificity: -1}
+		for _, spec := range specs {
+			if s := matches(spec, offer); s > m.specificity {
+				m = match{q: spec.Q, specificity: s}
+			}
+		}
+		if m.specificity >= 0 && m.q > bestQ {
+			bestOffer, bestQ = offer, m.q
+		}
+	}
+	return bestOffer, bestQ > 0
+}
+
+// ContentType picks the best of the offered media types for the Accept
+// header in h. Without an Accept header the first offer is picked.
+func ContentType(h *headers.Headers, offers []string) (string, bool) {
+	accept, ok := h.Get("Accept")
+	if !ok {
+		return first(offers)
+	}
+	return best(ParseAccept(accept), offers, func(spec Spec, offer string) int {
+		mediaType, params, err := mime.ParseMediaType(offer)
+		if err != nil {
+			return -1
+		}
+		offerType, offerSubtype, _ := strings.Cut(mediaType, "/")
+		specType, specSubtype, _ := strings.Cut(spec.Value, "/")
+
+		switch {
+		case specType == "*" && specSubtype == "*":
+			return 0
+		case specType != offerType:
+			return -1
+		case specSubtype == "*":
+			return 1
+		case specSubtype != offerSubtype:
+			return -1
+		}
+		for name, value := range spec.Params {
+			if params[name] != value {
+				return -1
+			}
+		}
+		return 2 + len(spec.Params)
+	})
+}
+
+// Language picks the best of the offered language tags for the
+// Accept-Language header in h. A range matches a tag equal to it or starting
+// with it followed by a hyphen, so "en" matches "en-GB". Without an
+// Accept-Language header the first offer is picked.
+func Language(h *headers.Headers, offers []string) (string, bool) {
+	acceptLanguage, ok := h.Get("Accept-Language")
+	if !ok {
+		return first(offers)
+	}
+	return best(ParseAccept(acceptLanguage), offers, func(spec Spec, offer string) int {
+		offer = strings.ToLower(offer)
+		switch {
+		case spec.Value == "*":
+			return 0
+		case offer == spec.Value || strings.HasPrefix(offer, spec.Value+"-"):
+			return strings.Count(spec.Value, "-") + 1
+		default:
+			return -1
+		}
+	})
+}
+
+// Encoding picks the best of the offered content codings for the
+// Accept-Encoding header in h. "identity" is acceptable unless excluded
+// explicitly. Without an Accept-Encoding header only "identity" is picked,
+// since clients that do not send one rarely expect compressed content.
+func Encoding(h *headers.Headers, offers []string) (string, bool) {
+	acceptEncoding, ok := h.Get("Accept-Encoding")
+	if !ok {
+		if slices.Contains(offers, "identity") {
+			return "identity", true
+		}
+		return "", false
+	}
+
+	specs := ParseAccept(acceptEncoding)
+	if !slices.ContainsFunc(specs, func(s Spec) bool { return s.Value == "identity" || s.Value == "*" }) {
+		// identity is acceptable, but below anything the client asked for
+		specs = append(specs, Spec{Value: "identity", Q: 0.001})
+	}
+	return best(specs, offers, func(spec Spec, offer string) int {
+		switch {
+		case spec.Value == "*":
+			return 0
+		case strings.EqualFold(spec.Value, offer):
+			return 1
+		default:
+			return -1
+		}
+	})
+}
+
+func first(offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	return offers[0], true
+}
+
+// Vary adds field to the Vary header in h unless it is listed already.
+// Responses picked by negotiation have to name the request headers they
+// depend on, so that caches do not serve them to other clients.
+func Vary(h *headers.Headers, field string) {
+	vary, _ := h.Get("Vary")
+	for _, listed := range strings.Split(vary, ",") {
+		listed = strings.TrimSpace(listed)
+		if listed == "*" || strings.EqualFold(listed, field) {
+			return
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// NotAcceptable answers with 406 Not Acceptable, listing the offers the
+// client could have asked for.
+func NotAcceptable(w *response.Writer, offers []string) error {
+	body := "Not Acceptable, available: " + strings.Join(offers, ", ") + "\n"
+	if err := w.WriteStatusLine(response.NOT_ACCEPTABLE); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(response.GetDefaultHeaders(len(body))); err != nil {
+		return err
+	}
+	_, err := w.WriteBody([]byte(body))
+	return err
+}
@@ -0,0 +1,127 @@
+package negotiate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/response"
+)
+
+func withHeader(name string, value string) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Add(name, value)
+	return h
+}
+
+func TestParseAccept(t *testing.T) {
+	// Test: Qualities, parameters and malformed elements
+	specs := ParseAccept(`text/html;level=1, Text/Plain ;q=0.5, */*;q=0.1, image/png;q=2, ,application/json;q=abc`)
+	assert.Equal(t, []Spec{
+		{Value: "text/html", Q: 1, Params: map[string]string{"level": "1"}},
+		{Value: "text/plain", Q: 0.5},
+		{Value: "*/*", Q: 0.1},
+	}, specs)
+}
+
+func TestContentType(t *testing.T) {
+	offers := []string{"text/html", "text/plain", "application/json"}
+
+	for accept, want := range map[string]string{
+		"application/json":                       "application/json",
+		"text/*;q=0.5, application/json;q=0.4":   "text/html",
+		"text/plain, text/*;q=0.2":               "text/plain",
+		"*/*":                                    "text/html",
+		"text/*, text/html;q=0":                  "text/plain",
+		"application/*;q=0.9, text/plain;q=0.95": "text/plain",
+	} {
+		got, ok := ContentType(withHeader("Accept", accept), offers)
+		require.True(t, ok, accept)
+		assert.Equal(t, want, got, accept)
+	}
+
+	// Test: Parameters on the range have to match
+	got, ok := ContentType(withHeader("Accept", "text/html;level=1, text/html;level=2;q=0.3"),
+		[]string{"text/html;level=2", "text/html;level=1"})
+	require.True(t, ok)
+	assert.Equal(t, "text/html;level=1", got)
+
+	// Test: Nothing acceptable
+	_, ok = ContentType(withHeader("Accept", "image/png, text/*;q=0"), offers)
+	assert.False(t, ok)
+
+	// Test: No Accept header
+	got, ok = ContentType(headers.NewHeaders(), offers)
+	require.True(t, ok)
+	assert.Equal(t, "text/html", got)
+}
+
+func TestLanguage(t *testing.T) {
+	offers := []string{"en-US", "de", "fr-CA"}
+
+	for acceptLanguage, want := range map[string]string{
+		"de-DE, de;q=0.8, en;q=0.5": "de",
+		"fr":                        "fr-CA",
+		"EN":                        "en-US",
+		"*;q=0.5, de;q=0":           "en-US",
+		"es, en-us;q=0.1":           "en-US",
+	} {
+		got, ok := Language(withHeader("Accept-Language", acceptLanguage), offers)
+		require.True(t, ok, acceptLanguage)
+		assert.Equal(t, want, got, acceptLanguage)
+	}
+
+	_, ok := Language(withHeader("Accept-Language", "es, it"), offers)
+	assert.False(t, ok)
+}
+
+func TestEncoding(t *testing.T) {
+	offers := []string{"gzip", "deflate", "identity"}
+
+	for acceptEncoding, want := range map[string]string{
+		"gzip, deflate":          "gzip",
+		"deflate, gzip;q=0.5":    "deflate",
+		"br":                     "identity",
+		"":                       "identity",
+		"*":                      "gzip",
+		"gzip;q=0, *":            "deflate",
+		"identity;q=0.5, gzip":   "gzip",
+		"GZIP;q=0.2, identity":   "identity",
+		"br;q=1, deflate;q=0.01": "deflate",
+	} {
+		got, ok := Encoding(withHeader("Accept-Encoding", acceptEncoding), offers)
+		require.True(t, ok, acceptEncoding)
+		assert.Equal(t, want, got, acceptEncoding)
+	}
+
+	// Test: Identity excluded
+	_, ok := Encoding(withHeader("Accept-Encoding", "br, *;q=0"), offers)
+	assert.False(t, ok)
+
+	// Test: No Accept-Encoding header
+	got, ok := Encoding(headers.NewHeaders(), offers)
+	require.True(t, ok)
+	assert.Equal(t, "identity", got)
+}
+
+func TestVary(t *testing.T) {
+	h := headers.NewHeaders()
+	Vary(h, "Accept")
+	Vary(h, "accept")
+	Vary(h, "Accept-Encoding")
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, h.Values("Vary"))
+
+	h = withHeader("Vary", "*")
+	Vary(h, "Accept")
+	assert.Equal(t, []string{"*"}, h.Values("Vary"))
+}
+
+func TestNotAcceptable(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, NotAcceptable(response.NewWriter(buf), []string{"text/html", "text/plain"}))
+	assert.Contains(t, buf.String(), "HTTP/1.1 406 Not Acceptable\r\n")
+	assert.Contains(t, buf.String(), "available: text/html, text/plain\n")
+}
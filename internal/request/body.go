@@ -0,0 +1,95 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+// body streams the request body from the connection, decoding it with the
+// same state machine that parsed the request line and headers.
+type body struct {
+	request *Request
+	reader  *Reader
+	closed  bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+
+	r := b.request
+	rr := b.reader
+	if len(r.pending) == 0 && rr.Buffered() == 0 && len(p) >= len(rr.buf) {
+		if n, ok, err := b.readDirect(p); ok {
+			return n, err
+		}
+	}
+
+	for len(r.pending) == 0 && r.State != DONE {
+		bytesParsed, err := r.parse(rr.buffered())
+		if err != nil {
+			return 0, err
+		}
+		rr.consume(bytesParsed)
+
+		if len(r.pending) > 0 || r.State == DONE {
+			break
+		}
+
+		if err := rr.fill(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+
+	if len(r.pending) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// readDirect reads body data straight from the connection into p, skipping
+// the buffer, so that large bodies are not copied through it piece by piece.
+// It reports false when the parser is not in the middle of body data.
+func (b *body) readDirect(p []byte) (int, bool, error) {
+	r := b.request
+	var left *int64
+	switch {
+	case r.State == READING_BODY:
+		left = &r.bodyLeft
+	case r.State == READING_CHUNK_DATA && r.chunkLeft > 0:
+		left = &r.chunkLeft
+	default:
+		return 0, false, nil
+	}
+
+	n, err := b.reader.reader.Read(p[:min(int64(len(p)), *left)])
+	*left -= int64(n)
+	if r.State == READING_BODY && r.bodyLeft == 0 {
+		r.State = DONE
+	}
+	if n > 0 {
+		return n, true, nil
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return 0, true, err
+}
+
+// Close discards whatever is left of the body, so that the connection is
+// positioned at the start of the next request.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, b)
+	b.closed = true
+	return err
+}
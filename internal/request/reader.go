@@ -0,0 +1,133 @@
+package request
+
+import (
+	"errors"
+	"io"
+
+	"http-protocol-go/internal/headers"
+)
+
+// Reader reads consecutive requests from one connection. Bytes read past the
+// end of a request stay buffered for the next one, so requests a client
+// pipelines without waiting for responses are not lost.
+type Reader struct {
+	reader io.Reader
+	limits Limits
+	// buf[start:end] holds the bytes read but not parsed yet
+	buf   []byte
+	start int
+	end   int
+	// maxBuf is how far buf may grow
+	maxBuf int
+	// last is the body of the previous request, which has to be consumed
+	// before the next request starts
+	last *body
+}
+
+func NewReader(reader io.Reader, limits Limits) *Reader {
+	return &Reader{
+		reader: reader,
+		limits: limits,
+		buf:    make([]byte, bufferSize),
+		// a request line allowed by limits has to fit, CRLF included
+		maxBuf: max(maxBufferSize, limits.MaxRequestLineBytes+len(crlf)),
+	}
+}
+
+// Buffered returns the number of bytes read from the connection that do not
+// belong to a request returned so far.
+func (rr *Reader) Buffered() int {
+	return rr.end - rr.start
+}
+
+// buffered returns the bytes read but not parsed yet.
+func (rr *Reader) buffered() []byte {
+	return rr.buf[rr.start:rr.end]
+}
+
+// ReadRequest parses the next request line and headers. The body of the
+// previous request is discarded if it was not read completely. At the end of
+// the stream it returns io.EOF, or io.ErrUnexpectedEOF if a request was cut
+// short.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if rr.last != nil {
+		if err := rr.last.Close(); err != nil {
+			return nil, err
+		}
+		rr.last = nil
+	}
+
+	request := &Request{
+		State:    INIT,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		limits:   rr.limits,
+	}
+
+	for request.State == INIT || request.State == READING_HEADERS {
+		// leftovers of a previous request may already hold this one
+		bytesParsed, err := request.parse(rr.buffered())
+		if err != nil {
+			return nil, err
+		}
+		rr.consume(bytesParsed)
+		if bytesParsed > 0 {
+			continue
+		}
+
+		if err := rr.fill(); err != nil {
+			if errors.Is(err, errBufferFull) {
+				if request.State == INIT {
+					return nil, ErrRequestLineTooLong
+				}
+				return nil, ErrHeadersTooLarge
+			}
+			if errors.Is(err, io.EOF) {
+				if request.State == INIT && rr.Buffered() == 0 {
+					return nil, io.EOF
+				}
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+
+	rr.last = &body{request: request, reader: rr}
+	request.Body = rr.last
+	return request, nil
+}
+
+// fill reads more bytes from the connection. Unparsed bytes are moved to the
+// front of the buffer first, and the buffer only grows when a single line does
+// not fit, up to maxBuf.
+func (rr *Reader) fill() error {
+	if rr.start > 0 {
+		copy(rr.buf, rr.buffered())
+		rr.end -= rr.start
+		rr.start = 0
+	}
+	if rr.end == len(rr.buf) {
+		if len(rr.buf) >= rr.maxBuf {
+			return errBufferFull
+		}
+		newBuf := make([]byte, min(len(rr.buf)*2, rr.maxBuf))
+		copy(newBuf, rr.buf[:rr.end])
+		rr.buf = newBuf
+	}
+
+	bytesRead, err := rr.reader.Read(rr.buf[rr.end:])
+	rr.end += bytesRead
+	if bytesRead > 0 {
+		return nil
+	}
+	return err
+}
+
+// consume drops n parsed bytes from the front of the buffer.
+func (rr *Reader) consume(n int) {
+	rr.start += n
+	if rr.start == rr.end {
+		rr.start = 0
+		rr.end = 0
+	}
+}
@@ -0,0 +1,155 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderPipelining(t *testing.T) {
+	// Test: Pipelined requests with bodies
+	rr := NewReader(&chunkReader{
+		data: "POST /one HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc" +
+			"POST /two HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nde\r\n0\r\n\r\n" +
+			"GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 64,
+	}, DefaultLimits)
+
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.RequestLine.Target)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(body))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.Target)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "de", string(body))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/three", r.RequestLine.Target)
+	assert.Equal(t, 0, rr.Buffered())
+
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Empty lines between requests are ignored
+	rr = NewReader(&chunkReader{
+		data: "\r\nGET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+			"POST /two HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc\r\n\r\n" +
+			"GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n\r\n",
+		numBytesPerRead: 1,
+	}, DefaultLimits)
+	for _, target := range []string{"/one", "/two", "/three"} {
+		r, err = rr.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, target, r.RequestLine.Target)
+	}
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Unread body is skipped
+	rr = NewReader(&chunkReader{
+		data: "POST /one HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc" +
+			"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 5,
+	}, DefaultLimits)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.Target)
+
+	// Test: Truncated pipelined request
+	rr = NewReader(&chunkReader{
+		data:            "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\nGET /two HT",
+		numBytesPerRead: 64,
+	}, DefaultLimits)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, 11, rr.Buffered())
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// countingReader counts the Read calls reaching the connection.
+type countingReader struct {
+	io.Reader
+	reads int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	return cr.Reader.Read(p)
+}
+
+func TestReaderLargeBody(t *testing.T) {
+	// Test: Large body is read in large pieces
+	payload := strings.Repeat("x", 1<<20)
+	conn := &countingReader{Reader: strings.NewReader(
+		"POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1048576\r\n\r\n" + payload,
+	)}
+	r, err := NewReader(conn, DefaultLimits).ReadRequest()
+	require.NoError(t, err)
+	// hide io.Discard's ReadFrom so that the copy reads 32 KiB at a time
+	n, err := io.CopyBuffer(struct{ io.Writer }{io.Discard}, r.Body, make([]byte, 32<<10))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), n)
+	assert.Less(t, conn.reads, 64)
+
+	// Test: Large chunks are read in large pieces
+	chunk := strings.Repeat("y", 256<<10)
+	conn = &countingReader{Reader: strings.NewReader(
+		"POST /upload HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"40000\r\n" + chunk + "\r\n40000\r\n" + chunk + "\r\n0\r\n\r\n",
+	)}
+	r, err = NewReader(conn, DefaultLimits).ReadRequest()
+	require.NoError(t, err)
+	n, err = io.CopyBuffer(struct{ io.Writer }{io.Discard}, r.Body, make([]byte, 32<<10))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*len(chunk)), n)
+	assert.Less(t, conn.reads, 64)
+
+	// Test: Truncated body read directly
+	conn = &countingReader{Reader: strings.NewReader(
+		"POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100000\r\n\r\nabc",
+	)}
+	r, err = NewReader(conn, DefaultLimits).ReadRequest()
+	require.NoError(t, err)
+	_, err = io.CopyBuffer(struct{ io.Writer }{io.Discard}, r.Body, make([]byte, 32<<10))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReaderBufferLimit(t *testing.T) {
+	// Test: Header line longer than the buffer can grow
+	_, err := RequestFromReaderWithLimits(strings.NewReader(
+		"GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: "+strings.Repeat("a", maxBufferSize)+"\r\n\r\n",
+	), Limits{})
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Request line longer than the buffer can grow
+	_, err = RequestFromReaderWithLimits(strings.NewReader(
+		"GET /"+strings.Repeat("a", maxBufferSize)+" HTTP/1.1\r\n\r\n",
+	), Limits{})
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Request line limit above the buffer size is honoured
+	target := "/" + strings.Repeat("a", 2*maxBufferSize)
+	r, err := RequestFromReaderWithLimits(strings.NewReader(
+		"GET "+target+" HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	), Limits{MaxRequestLineBytes: 4 * maxBufferSize})
+	require.NoError(t, err)
+	assert.Equal(t, target, r.RequestLine.Target)
+
+	_, err = RequestFromReaderWithLimits(strings.NewReader(
+		"GET /"+strings.Repeat("a", 4*maxBufferSize)+" HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	), Limits{MaxRequestLineBytes: 4 * maxBufferSize})
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+}
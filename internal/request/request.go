@@ -2,16 +2,30 @@ package request
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
 
+	"http-protocol-go/internal/cookie"
+	"http-protocol-go/internal/form"
 	"http-protocol-go/internal/headers"
 )
 
-const bufferSize = 8
+// bufferSize is the initial size of the connection buffer of a Reader. It
+// grows up to maxBufferSize when a request line or header line does not fit,
+// which is enough for the longest header line headers.Parse accepts, or
+// further when Limits.MaxRequestLineBytes allows longer request lines.
+const (
+	bufferSize    = 4 << 10
+	maxBufferSize = 128 << 10
+)
+
 const crlf = "\r\n"
 
 const (
@@ -19,13 +33,74 @@ const (
 	DONE
 	READING_HEADERS
 	READING_BODY
+	READING_CHUNK_SIZE
+	READING_CHUNK_DATA
+	READING_TRAILERS
+)
+
+var (
+	ErrRequestLineTooLong = errors.New("request line too long")
+	ErrHeadersTooLarge    = errors.New("request headers too large")
+	// ErrHeaderValueTooLong is returned for a single field value longer than
+	// headers.MaxValueLength, however small the headers are overall.
+	ErrHeaderValueTooLong = fmt.Errorf("%w: %w", ErrHeadersTooLarge, headers.ErrValueTooLong)
+	ErrBodyTooLarge       = errors.New("request body too large")
+	// ErrVersionNotSupported is returned for a well-formed HTTP version with a
+	// major version other than 1.
+	ErrVersionNotSupported = errors.New("http version not supported")
+	// ErrUnsupportedTransferCoding is returned for a body sent with a transfer
+	// coding other than chunked.
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+
+	errBufferFull = errors.New("line does not fit the buffer")
 )
 
+// maxChunkLineBytes bounds a chunk size line including its extensions.
+const maxChunkLineBytes = 4096
+
+// Limits bounds the size of a request. A zero field means no limit.
+type Limits struct {
+	// MaxRequestLineBytes bounds the request line. Without a limit, request
+	// lines are still bounded by the 128 KiB the connection buffer grows to.
+	MaxRequestLineBytes int
+	// MaxHeaderBytes bounds all header lines together, and separately all
+	// trailer lines of a chunked body. A single line is bounded by the 128 KiB
+	// connection buffer regardless, and its value by headers.MaxValueLength.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	MaxBodyBytes   int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      1 << 20,
+	MaxHeaderCount:      100,
+}
+
 type Request struct {
 	State       int
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
+	// Target is the parsed RequestLine.Target.
+	Target   *Target
+	Headers  *headers.Headers
+	Body     io.ReadCloser
+	Trailers *headers.Headers
+	// TLS describes the connection the request arrived on, nil for plaintext
+	// connections. Verified client certificates are in TLS.PeerCertificates.
+	TLS *tls.ConnectionState
+
+	pathValues map[string]string
+
+	limits     Limits
+	fieldBytes int
+	fieldCount int
+	bodyBytes  int64
+
+	// pending holds body bytes decoded by the state machine that were not
+	// handed out by Body yet.
+	pending   []byte
+	bodyLeft  int64
+	chunkLeft int64
 }
 
 type RequestLine struct {
@@ -34,13 +109,22 @@ type RequestLine struct {
 	Method      string
 }
 
-var METHODS = []string{"GET", "POST"}
+// METHODS are the methods defined by RFC 9110 and RFC 5789 (PATCH). Other
+// methods are parsed as long as they are valid tokens, leaving it to the server
+// to reject them.
+var METHODS = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	eol := bytes.Index(data, []byte(crlf))
 	if eol < 0 {
+		if bytes.IndexByte(data, '\n') >= 0 {
+			return nil, 0, errors.New("bare LF in request line")
+		}
 		return nil, 0, nil
 	}
+	if bytes.ContainsAny(data[:eol], "\r\n") {
+		return nil, 0, errors.New("bare CR or LF in request line")
+	}
 
 	lines := strings.Split(string(data[:eol]), crlf)
 	if len(lines) == 0 {
@@ -54,16 +138,15 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	}
 
 	method := parts[0]
-	if !slices.Contains(METHODS, method) {
-		return nil, 0, errors.New("method not supported")
+	if !headers.IsToken(method) {
+		return nil, 0, errors.New("invalid method")
 	}
 
 	target := parts[1]
 
-	version := parts[2]
-	version = version[len(version)-3:]
-	if version != "1.1" {
-		return nil, 0, errors.New("http version must be 1.1")
+	version, err := parseVersion(parts[2])
+	if err != nil {
+		return nil, 0, err
 	}
 
 	return &RequestLine{
@@ -73,6 +156,27 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	}, eol + 2, nil
 }
 
+// parseVersion checks that proto is exactly HTTP/x.y with single digits and
+// returns "x.y". Minor versions above 1.1 are served as 1.1, the highest one
+// we implement, see RFC 9110 section 2.5.
+func parseVersion(proto string) (string, error) {
+	version, ok := strings.CutPrefix(proto, "HTTP/")
+	if !ok || len(version) != 3 || !isDigit(version[0]) || version[1] != '.' || !isDigit(version[2]) {
+		return "", errors.New("malformed http version")
+	}
+	if version[0] != '1' {
+		return "", ErrVersionNotSupported
+	}
+	if version != "1.0" {
+		return "1.1", nil
+	}
+	return version, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
 func (r *Request) parse(data []byte) (int, error) {
 	totalParsed := 0
 
@@ -94,6 +198,17 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.State {
 	case INIT:
+		// empty lines ahead of a request are ignored, as some clients send
+		// a stray CRLF after a body, see RFC 9112 section 2.2
+		if bytes.HasPrefix(data, []byte(crlf)) {
+			return len(crlf), nil
+		}
+
+		maxLen := r.limits.MaxRequestLineBytes
+		if eol := bytes.Index(data, []byte(crlf)); maxLen > 0 && (eol > maxLen || eol < 0 && len(data) > maxLen) {
+			return 0, ErrRequestLineTooLong
+		}
+
 		request, n, err := parseRequestLine(data)
 		if err != nil {
 			return 0, err
@@ -101,47 +216,100 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if n == 0 {
 			return 0, nil
 		}
+		target, err := ParseTarget(request.Method, request.Target)
+		if err != nil {
+			return 0, err
+		}
 		r.RequestLine = *request
+		r.Target = target
 		r.State = READING_HEADERS
 		return n, nil
 
 	case READING_HEADERS:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.parseField(r.Headers, data)
 		if err != nil {
 			r.State = DONE
 			return 0, err
 		}
 		if done {
-			if _, exists := r.Headers.Get("Content-Length"); exists {
-				r.State = DONE
+			if err := r.checkHost(); err != nil {
+				return 0, err
+			}
+			if err := r.startBody(); err != nil {
+				return 0, err
 			}
-			r.State = READING_BODY
 		}
 		return n, nil
 
 	case READING_BODY:
-		contentLenHeader, ok := r.Headers.Get("Content-Length")
-		if !ok {
+		chunk := data[:min(int64(len(data)), r.bodyLeft)]
+		r.pending = append(r.pending, chunk...)
+		r.bodyLeft -= int64(len(chunk))
+
+		if r.bodyLeft == 0 {
 			r.State = DONE
-			return len(data), nil
 		}
 
-		contentLen, err := strconv.Atoi(contentLenHeader)
+		return len(chunk), nil
+
+	case READING_CHUNK_SIZE:
+		eol := bytes.Index(data, []byte(crlf))
+		if eol < 0 {
+			if bytes.IndexByte(data, '\n') >= 0 {
+				return 0, errors.New("bare LF in chunk size line")
+			}
+			if len(data) > maxChunkLineBytes {
+				return 0, errors.New("chunk size line too long")
+			}
+			return 0, nil
+		}
+
+		size, err := parseChunkSize(data[:eol])
 		if err != nil {
-			return 0, errors.New("invalid content length value")
+			return 0, err
 		}
 
-		r.Body = append(r.Body, data...)
+		r.bodyBytes += size
+		if r.limits.MaxBodyBytes > 0 && r.bodyBytes > r.limits.MaxBodyBytes {
+			return 0, ErrBodyTooLarge
+		}
 
-		if len(r.Body) > contentLen {
-			return 0, errors.New("body length greater than content length")
+		if size == 0 {
+			r.fieldBytes = 0
+			r.fieldCount = 0
+			r.State = READING_TRAILERS
+		} else {
+			r.chunkLeft = size
+			r.State = READING_CHUNK_DATA
+		}
+		return eol + 2, nil
+
+	case READING_CHUNK_DATA:
+		if r.chunkLeft > 0 {
+			chunk := data[:min(int64(len(data)), r.chunkLeft)]
+			r.pending = append(r.pending, chunk...)
+			r.chunkLeft -= int64(len(chunk))
+			return len(chunk), nil
 		}
 
-		if len(r.Body) == contentLen {
-			r.State = DONE
+		if len(data) < len(crlf) {
+			return 0, nil
 		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, errors.New("chunk data not terminated by CRLF")
+		}
+		r.State = READING_CHUNK_SIZE
+		return len(crlf), nil
 
-		return len(data), nil
+	case READING_TRAILERS:
+		n, done, err := r.parseField(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			r.State = DONE
+		}
+		return n, nil
 
 	case DONE:
 		return 0, errors.New("trying to read data in DONE state")
@@ -151,41 +319,277 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	}
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
+// parseField parses a single header or trailer line into h, enforcing the
+// header limits.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+	n, done, err := h.Parse(data)
+	if errors.Is(err, headers.ErrValueTooLong) {
+		return 0, false, ErrHeaderValueTooLong
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	maxBytes := r.limits.MaxHeaderBytes
+	if n == 0 {
+		if maxBytes > 0 && r.fieldBytes+len(data) > maxBytes {
+			return 0, false, ErrHeadersTooLarge
+		}
+		return 0, false, nil
+	}
 
-	readIdx := 0
-	request := &Request{
-		State:   INIT,
-		Headers: headers.NewHeaders(),
+	r.fieldBytes += n
+	if maxBytes > 0 && r.fieldBytes > maxBytes {
+		return 0, false, ErrHeadersTooLarge
 	}
 
-	for request.State != DONE {
-		if readIdx >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	if !done {
+		r.fieldCount++
+		if r.limits.MaxHeaderCount > 0 && r.fieldCount > r.limits.MaxHeaderCount {
+			return 0, false, ErrHeadersTooLarge
 		}
+	}
 
-		bytesRead, err := reader.Read(buf[readIdx:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				request.State = DONE
-				break
-			}
-			return nil, err
+	return n, done, nil
+}
+
+// checkHost requires exactly one Host header from HTTP/1.1 clients and at most
+// one from HTTP/1.0 ones, see RFC 9112 section 3.2. Parsers picking different
+// ones of several Host headers disagree on where a request goes, so a Host
+// that is not a single valid authority is rejected as well.
+func (r *Request) checkHost() error {
+	hosts := r.Headers.Values("Host")
+	switch {
+	case len(hosts) > 1:
+		return errors.New("multiple Host headers")
+	case len(hosts) == 0 && !r.IsHTTP10():
+		return errors.New("missing Host header")
+	case len(hosts) == 1 && hosts[0] != "" && (strings.ContainsAny(hosts[0], " \t") || !validAuthority(hosts[0], false)):
+		return errors.New("invalid Host header")
+	}
+	return nil
+}
+
+// startBody picks the body framing once all headers are known, following
+// RFC 9112 section 6.3. Requests whose framing could be read differently by
+// another parser on the way are rejected rather than guessed at.
+func (r *Request) startBody() error {
+	transferEncoding, hasTransferEncoding := r.Headers.Get("Transfer-Encoding")
+	contentLenHeader, hasContentLen := r.Headers.Get("Content-Length")
+
+	if hasTransferEncoding {
+		if hasContentLen {
+			return errors.New("both Transfer-Encoding and Content-Length present")
+		}
+		if r.IsHTTP10() {
+			return errors.New("Transfer-Encoding in HTTP/1.0 request")
+		}
+		if err := checkTransferEncoding(transferEncoding); err != nil {
+			return err
 		}
+		r.State = READING_CHUNK_SIZE
+		return nil
+	}
 
-		readIdx += bytesRead
+	if !hasContentLen {
+		r.State = DONE
+		return nil
+	}
 
-		bytesParsed, err := request.parse(buf[:readIdx])
-		if err != nil {
-			return nil, err
+	contentLen, err := parseContentLength(contentLenHeader)
+	if err != nil {
+		return err
+	}
+	if r.limits.MaxBodyBytes > 0 && contentLen > r.limits.MaxBodyBytes {
+		return ErrBodyTooLarge
+	}
+
+	r.bodyLeft = contentLen
+	if contentLen == 0 {
+		r.State = DONE
+	} else {
+		r.State = READING_BODY
+	}
+	return nil
+}
+
+// checkTransferEncoding accepts only chunked as the one and final transfer
+// coding, the only one we can decode.
+func checkTransferEncoding(transferEncoding string) error {
+	codings := strings.Split(transferEncoding, ",")
+	for i, coding := range codings {
+		coding = strings.Trim(coding, " \t")
+		switch {
+		case !headers.IsToken(coding):
+			return errors.New("invalid transfer coding")
+		case !strings.EqualFold(coding, "chunked"):
+			return ErrUnsupportedTransferCoding
+		case i != len(codings)-1:
+			return errors.New("chunked applied more than once")
+		}
+	}
+	return nil
+}
+
+// parseContentLength parses a Content-Length value, which may be a list when
+// the header was repeated. Repeated values have to be identical.
+func parseContentLength(value string) (int64, error) {
+	values := strings.Split(value, ",")
+	first := strings.Trim(values[0], " \t")
+	for _, v := range values[1:] {
+		if strings.Trim(v, " \t") != first {
+			return 0, errors.New("conflicting Content-Length values")
+		}
+	}
+
+	if first == "" || strings.ContainsFunc(first, func(c rune) bool { return c < '0' || c > '9' }) {
+		return 0, errors.New("invalid content length value")
+	}
+	contentLen, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid content length value")
+	}
+	return contentLen, nil
+}
+
+// parseChunkSize parses a chunk size line, ignoring chunk extensions: they
+// carry no meaning for us, only the size matters.
+func parseChunkSize(line []byte) (int64, error) {
+	if bytes.ContainsAny(line, "\r\n") {
+		return 0, errors.New("bare CR or LF in chunk size line")
+	}
+	sizeField, _, _ := bytes.Cut(line, []byte(";"))
+	sizeField = bytes.TrimRight(sizeField, " \t")
+
+	if len(sizeField) == 0 || bytes.ContainsFunc(sizeField, func(c rune) bool {
+		return !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F')
+	}) {
+		return 0, errors.New("invalid chunk size")
+	}
+	size, err := strconv.ParseInt(string(sizeField), 16, 64)
+	if err != nil {
+		return 0, errors.New("invalid chunk size")
+	}
+	return size, nil
+}
+
+// IsHTTP10 reports whether the request was sent with HTTP/1.0.
+func (r *Request) IsHTTP10() bool {
+	return r.RequestLine.HttpVersion == "1.0"
+}
+
+// WantsClose reports whether the connection has to be closed after this
+// request: HTTP/1.1 connections persist unless the client sends
+// "Connection: close", HTTP/1.0 ones only with "Connection: keep-alive".
+func (r *Request) WantsClose() bool {
+	if r.hasConnectionOption("close") {
+		return true
+	}
+	return r.IsHTTP10() && !r.hasConnectionOption("keep-alive")
+}
+
+func (r *Request) hasConnectionOption(option string) bool {
+	connection, ok := r.Headers.Get("Connection")
+	if !ok {
+		return false
+	}
+	for _, o := range strings.Split(connection, ",") {
+		if strings.EqualFold(strings.TrimSpace(o), option) {
+			return true
 		}
+	}
+	return false
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue" and
+// holds the body back until it receives 100 Continue. The expectation is
+// ignored for HTTP/1.0 clients, which cannot receive interim responses.
+func (r *Request) ExpectsContinue() bool {
+	expect, ok := r.Headers.Get("Expect")
+	return ok && !r.IsHTTP10() && strings.EqualFold(strings.TrimSpace(expect), "100-continue")
+}
+
+// IsStandardMethod reports whether the request uses one of METHODS.
+func (r *Request) IsStandardMethod() bool {
+	return slices.Contains(METHODS, r.RequestLine.Method)
+}
+
+// Path returns the percent-decoded path of the target.
+func (r *Request) Path() string {
+	return r.Target.Path
+}
+
+// Query parses the query string of the target. Malformed pairs are skipped.
+func (r *Request) Query() url.Values {
+	query, _ := url.ParseQuery(r.Target.RawQuery)
+	return query
+}
+
+// QueryValue returns the first value of the query parameter name, or "".
+func (r *Request) QueryValue(name string) string {
+	return r.Query().Get(name)
+}
+
+// Cookies returns the cookies the client sent.
+func (r *Request) Cookies() []*cookie.Cookie {
+	return cookie.Parse(r.Headers)
+}
 
-		copy(buf, buf[bytesParsed:])
-		readIdx -= bytesParsed
+// Cookie returns the first cookie named name, or false if there is none.
+func (r *Request) Cookie(name string) (*cookie.Cookie, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, true
+		}
 	}
+	return nil, false
+}
+
+// Form decodes an application/x-www-form-urlencoded or multipart/form-data
+// body within limits. The caller has to call RemoveAll on the form once done
+// with uploaded files.
+func (r *Request) Form(limits form.Limits) (*form.Form, error) {
+	contentType, _ := r.Headers.Get("Content-Type")
+	return form.Parse(r.Body, contentType, limits)
+}
+
+// MultipartReader returns a reader for the parts of a multipart/form-data
+// body, to stream uploads part by part instead of calling Form.
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	contentType, _ := r.Headers.Get("Content-Type")
+	return form.NewMultipartReader(r.Body, contentType)
+}
+
+// PathValue returns the value captured for a named wildcard of the route that
+// matched the request, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+func (r *Request) SetPathValue(name string, value string) {
+	if r.pathValues == nil {
+		r.pathValues = map[string]string{}
+	}
+	r.pathValues[name] = value
+}
+
+// ReadBody reads the whole body into memory and closes it.
+func (r *Request) ReadBody() ([]byte, error) {
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+// RequestFromReader parses the request line and headers from reader within
+// DefaultLimits. The body is not read up front: Request.Body reads it from
+// reader on demand.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderWithLimits(reader, DefaultLimits)
+}
 
-	return request, nil
+// RequestFromReaderWithLimits is like RequestFromReader, failing with
+// ErrRequestLineTooLong, ErrHeadersTooLarge or ErrBodyTooLarge when the request
+// exceeds limits. Bytes sent after the request are lost, use a Reader to read
+// several requests from one connection.
+func RequestFromReaderWithLimits(reader io.Reader, limits Limits) (*Request, error) {
+	return NewReader(reader, limits).ReadRequest()
 }
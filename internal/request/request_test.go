@@ -1,12 +1,14 @@
 package request
 
 import (
-	"fmt"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/form"
 )
 
 type chunkReader struct {
@@ -76,21 +78,85 @@ func TestRequestLineParse(t *testing.T) {
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 
-	// Test: Invalid method (out of order, unsupported) Request line
+	// Test: Good DELETE Request line
+	reader = &chunkReader{
+		data:            "DELETE /coffee/1 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "DELETE", r.RequestLine.Method)
+	assert.True(t, r.IsStandardMethod())
+
+	// Test: Extension method is parsed but not standard
+	reader = &chunkReader{
+		data:            "PROPFIND /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 16,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "PROPFIND", r.RequestLine.Method)
+	assert.False(t, r.IsStandardMethod())
+
+	// Test: Invalid characters in method
 	reader = &chunkReader{
-		data:            "HELLO GET HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		data:            "G(E)T /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 16,
 	}
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 
-	// Test: Invalid version in Request line
+	// Test: Higher minor version is served as HTTP/1.1
 	reader = &chunkReader{
 		data:            "GET /coffee HTTP/1.2\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 8,
 	}
-	_, err = RequestFromReader(reader)
-	require.Error(t, err)
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+
+	// Test: Unsupported versions
+	for _, version := range []string{"HTTP/2.0", "HTTP/0.9"} {
+		reader = &chunkReader{
+			data:            "GET /coffee " + version + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 8,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+
+	// Test: Malformed versions
+	for _, version := range []string{"XHTTP/1.1", "HTTP/11", "HTTP/1.1.1", "http/1.1", "HTTP/1.x", "1.1", "1"} {
+		reader = &chunkReader{
+			data:            "GET /coffee " + version + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 8,
+		}
+		_, err = RequestFromReader(reader)
+		require.Error(t, err, version)
+		assert.NotErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+
+	// Test: HTTP/1.0 connection persistence
+	for _, c := range []struct {
+		version    string
+		connection string
+		wantsClose bool
+	}{
+		{"HTTP/1.1", "", false},
+		{"HTTP/1.1", "Connection: close\r\n", true},
+		{"HTTP/1.0", "", true},
+		{"HTTP/1.0", "Connection: Keep-Alive\r\n", false},
+		{"HTTP/1.0", "Connection: keep-alive, close\r\n", true},
+	} {
+		reader = &chunkReader{
+			data:            "GET /coffee " + c.version + "\r\nHost: localhost\r\n" + c.connection + "\r\n",
+			numBytesPerRead: 8,
+		}
+		r, err = RequestFromReader(reader)
+		require.NoError(t, err)
+		assert.Equal(t, c.version == "HTTP/1.0", r.IsHTTP10())
+		assert.Equal(t, c.wantsClose, r.WantsClose(), "%s %q", c.version, c.connection)
+	}
 }
 
 func TestRequestHeadersParse(t *testing.T) {
@@ -102,29 +168,29 @@ func TestRequestHeadersParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, []string{"localhost:42069"}, r.Headers.Values("host"))
+	assert.Equal(t, []string{"curl/7.81.0"}, r.Headers.Values("user-agent"))
+	assert.Equal(t, []string{"*/*"}, r.Headers.Values("accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\n\r\n",
+		data:            "GET / HTTP/1.0\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, 0, len(r.Headers))
+	assert.Equal(t, 0, r.Headers.Len())
 
 	// Test: Duplicate Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: localhost:42069\r\n\r\n",
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nAccept: text/html\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:42069", r.Headers["host"])
+	assert.Equal(t, []string{"text/html", "*/*"}, r.Headers.Values("accept"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -134,15 +200,15 @@ func TestRequestHeadersParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, r.Headers.Values("host"))
 
-	// // Test: Missing End of Headers
-	// reader = &chunkReader{
-	// 	data:            "GET / HTTP/1.1\r\nHost: localhost:42069",
-	// 	numBytesPerRead: 3,
-	// }
-	// _, err = RequestFromReader(reader)
-	// require.Error(t, err)
+	// Test: Missing End of Headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -166,7 +232,9 @@ func TestRequestBodyParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
 
 	// Test: Body longer than reported content length
 	reader = &chunkReader{
@@ -177,6 +245,34 @@ func TestRequestBodyParse(t *testing.T) {
 			"partial content",
 		numBytesPerRead: 3,
 	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "partial co", string(body))
+
+	// Test: Body shorter than reported content length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+
+	// Test: Invalid content length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: ten\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 
@@ -190,8 +286,10 @@ func TestRequestBodyParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
-	require.Equal(t, "0", r.Headers["content-length"])
-	require.Equal(t, 0, len(r.Body))
+	require.Equal(t, []string{"0"}, r.Headers.Values("content-length"))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(body))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -202,7 +300,9 @@ func TestRequestBodyParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
-	require.Equal(t, 0, len(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(body))
 
 	// Test: No Content-Length but Body Exists
 	reader = &chunkReader{
@@ -214,5 +314,422 @@ func TestRequestBodyParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
-	require.Equal(t, 0, len(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(body))
+
+	// Test: Body is read lazily in small pieces
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"abcdefghijklmnopqrstuvwxyz",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Less(t, reader.pos, len(reader.data))
+	p := make([]byte, 5)
+	n, err := io.ReadFull(r.Body, p)
+	require.NoError(t, err)
+	assert.Equal(t, "abcde", string(p[:n]))
+	rest, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "fghijklmnopqrstuvwxyz", string(rest))
+	require.NoError(t, r.Body.Close())
+}
+
+func TestRequestChunkedBodyParse(t *testing.T) {
+	// Test: Standard Chunked Body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"7\r\nworld!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, 0, r.Trailers.Len())
+
+	// Test: Chunk Extensions and Trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A;name=value\r\n0123456789\r\n" +
+			"0;last\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+	assert.Equal(t, []string{"abc"}, r.Trailers.Values("x-checksum"))
+
+	// Test: Invalid Chunk Size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\nHost: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+
+	// Test: Chunk Longer Than Declared Size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\nHost: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+
+	// Test: Missing Terminating Chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+}
+
+func TestRequestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        10,
+	}
+
+	// Test: Request within limits
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReaderWithLimits(reader, limits)
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+
+	// Test: Request line too long
+	reader = &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithLimits(reader, limits)
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Request line too long without line ending
+	reader = &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64),
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithLimits(reader, limits)
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Single header too long
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 64) + "\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithLimits(reader, limits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Header value over the value limit within the header limit
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: " + strings.Repeat("a", 100<<10) + "\r\n\r\n",
+		numBytesPerRead: 4096,
+	}
+	_, err = RequestFromReaderWithLimits(reader, DefaultLimits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Too many headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithLimits(reader, limits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Content-Length above the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\n01234567890",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithLimits(reader, limits)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body above the body limit
+	reader = &chunkReader{
+		data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"6\r\n012345\r\n6\r\n678901\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithLimits(reader, limits)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestRequestTargetParse(t *testing.T) {
+	// Test: Origin-form with query and percent-encoding
+	reader := &chunkReader{
+		data:            "GET /caf%C3%A9/menu?size=large&milk=oat&milk=soy HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 7,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, ORIGIN_FORM, r.Target.Form)
+	assert.Equal(t, "/café/menu", r.Path())
+	assert.Equal(t, "/caf%C3%A9/menu", r.Target.RawPath)
+	assert.Equal(t, "large", r.QueryValue("size"))
+	assert.Equal(t, []string{"oat", "soy"}, r.Query()["milk"])
+	assert.Equal(t, "", r.QueryValue("sugar"))
+
+	// Test: Query with semicolons is valid
+	reader = &chunkReader{
+		data:            "GET /x?a=1;b=2&c=3 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 7,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1;b=2&c=3", r.Target.RawQuery)
+	assert.Equal(t, "3", r.QueryValue("c"))
+
+	// Test: Absolute-form
+	target, err := ParseTarget("GET", "HTTP://www.example.org:8080/pub/index.html?q=1#top")
+	require.NoError(t, err)
+	assert.Equal(t, ABSOLUTE_FORM, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "www.example.org:8080", target.Host)
+	assert.Equal(t, "/pub/index.html", target.Path)
+	assert.Equal(t, "q=1", target.RawQuery)
+	assert.Equal(t, "top", target.Fragment)
+
+	// Test: Absolute-form without path
+	target, err = ParseTarget("GET", "http://[::1]:80?q=1")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:80", target.Host)
+	assert.Equal(t, "/", target.Path)
+	assert.Equal(t, "q=1", target.RawQuery)
+
+	// Test: Authority-form for CONNECT
+	target, err = ParseTarget("CONNECT", "www.example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, AUTHORITY_FORM, target.Form)
+	assert.Equal(t, "www.example.com:443", target.Host)
+
+	// Test: Asterisk-form for OPTIONS
+	target, err = ParseTarget("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, ASTERISK_FORM, target.Form)
+
+	// Test: Malformed targets
+	for _, c := range []struct{ method, target string }{
+		{"GET", "coffee"},
+		{"GET", "*"},
+		{"GET", "/bad%zzescape"},
+		{"GET", "/ok?bad=%zz"},
+		{"GET", "/ok?bad=%4"},
+		{"GET", "/caf\xc3\xa9"},
+		{"GET", "1http://example.com/"},
+		{"GET", "http://user@example.com/"},
+		{"GET", "http:///path"},
+		{"CONNECT", "www.example.com"},
+		{"CONNECT", "www.example.com:http"},
+		{"CONNECT", "/path"},
+		{"OPTIONS", "**"},
+	} {
+		_, err = ParseTarget(c.method, c.target)
+		assert.Error(t, err, "%s %s", c.method, c.target)
+	}
+
+	// Test: Malformed target is rejected by the parser
+	reader = &chunkReader{
+		data:            "GET coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 7,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+// parseAll parses a request including its body, returning the first error.
+func parseAll(data string) (*Request, []byte, error) {
+	r, err := RequestFromReader(&chunkReader{data: data, numBytesPerRead: 5})
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := r.ReadBody()
+	return r, body, err
+}
+
+func TestRequestSmuggling(t *testing.T) {
+	// Test: Known smuggling payloads are rejected
+	for name, payload := range map[string]string{
+		"CL.CL conflicting":     "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 8\r\n\r\nabcGET / HTTP/1.1\r\n\r\n",
+		"CL.CL in one line":     "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3, 8\r\n\r\nabcdefgh",
+		"CL.TE":                 "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED",
+		"TE.CL":                 "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n",
+		"TE.TE duplicate":       "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"TE not final":          "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n",
+		"TE obfuscated":         "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n",
+		"TE quoted":             "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: \"chunked\"\r\n\r\n0\r\n\r\n",
+		"TE in HTTP/1.0":        "POST / HTTP/1.0\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"TE space before colon": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n",
+		"TE leading space":      "POST / HTTP/1.1\r\nHost: a\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"TE leading tab":        "POST / HTTP/1.1\r\nHost: a\r\n\tTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"TE obs-fold":           "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\r\n chunked\r\n\r\n0\r\n\r\n",
+		"TE vertical tab":       "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\x0bchunked\r\n\r\n0\r\n\r\n",
+		"TE bare LF":            "POST / HTTP/1.1\r\nHost: a\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"TE bare CR":            "POST / HTTP/1.1\r\nHost: a\rTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"CL plus sign":          "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: +3\r\n\r\nabc",
+		"CL negative":           "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: -1\r\n\r\n",
+		"CL hex":                "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 0x3\r\n\r\nabc",
+		"CL empty":              "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: \r\n\r\n",
+		"CL overflow":           "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 99999999999999999999\r\n\r\n",
+		"request line bare LF":  "GET / HTTP/1.1\nHost: a\r\n\r\n",
+		"request line bare CR":  "GET /\r HTTP/1.1\r\nHost: a\r\n\r\n",
+		"all bare LF":           "GET / HTTP/1.1\nHost: a\n\n",
+		"chunk size plus sign":  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n+3\r\nabc\r\n0\r\n\r\n",
+		"chunk size 0x prefix":  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0x3\r\nabc\r\n0\r\n\r\n",
+		"chunk size leading ws": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n 3\r\nabc\r\n0\r\n\r\n",
+		"chunk size overflow":   "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\nfffffffffffffffff0\r\nabc\r\n0\r\n\r\n",
+		"chunk size bare LF":    "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\nabc\r\n0\r\n\r\n",
+		"chunk data too long":   "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcdef\r\n0\r\n\r\n",
+		"chunk data bare LF":    "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\n0\r\n\r\n",
+		"Host missing":          "GET / HTTP/1.1\r\n\r\n",
+		"Host duplicate":        "GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n",
+		"Host duplicate in 1.0": "GET / HTTP/1.0\r\nHost: a\r\nHost: b\r\n\r\n",
+		"Host in one line":      "GET / HTTP/1.1\r\nHost: a, b\r\n\r\n",
+		"trailer bare LF":       "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Trailer: a\nX-Other: b\r\n\r\n",
+		"trailer obs-fold":      "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Trailer: a\r\n b\r\n\r\n",
+	} {
+		_, _, err := parseAll(payload)
+		assert.Error(t, err, name)
+	}
+
+	// Test: Other transfer codings are not supported
+	_, _, err := parseAll("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n")
+	require.ErrorIs(t, err, ErrUnsupportedTransferCoding)
+
+	// Test: Identical repeated Content-Length values
+	_, body, err := parseAll("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\nabc")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(body))
+
+	// Test: Case-insensitive chunked with optional whitespace
+	_, body, err = parseAll("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\tChunked \r\n\r\n3 ;ext=1\r\nabc\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(body))
+}
+
+func TestRequestExpectsContinue(t *testing.T) {
+	for _, c := range []struct {
+		data            string
+		expectsContinue bool
+	}{
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-Continue\r\nContent-Length: 1\r\n\r\n", true},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1\r\n\r\n", false},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 200-ok\r\nContent-Length: 1\r\n\r\n", false},
+		{"POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 1\r\n\r\n", false},
+	} {
+		r, err := RequestFromReader(&chunkReader{data: c.data, numBytesPerRead: 4})
+		require.NoError(t, err)
+		assert.Equal(t, c.expectsContinue, r.ExpectsContinue(), "%q", c.data)
+	}
+}
+
+func TestRequestCookies(t *testing.T) {
+	r, err := RequestFromReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nCookie: session=abc; theme=dark; session=old\r\n\r\n",
+		numBytesPerRead: 8,
+	})
+	require.NoError(t, err)
+	assert.Len(t, r.Cookies(), 3)
+
+	// Test: First cookie with the name wins
+	c, ok := r.Cookie("session")
+	require.True(t, ok)
+	assert.Equal(t, "abc", c.Value)
+
+	_, ok = r.Cookie("missing")
+	assert.False(t, ok)
+}
+
+func TestRequestForm(t *testing.T) {
+	// Test: URL-encoded body
+	r, err := RequestFromReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\nHost: localhost\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\nContent-Length: 19\r\n\r\n" +
+			"name=coffee&size=xl",
+		numBytesPerRead: 8,
+	})
+	require.NoError(t, err)
+	f, err := r.Form(form.DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "coffee", f.Values.Get("name"))
+	assert.Equal(t, "xl", f.Values.Get("size"))
+
+	// Test: Multipart body read part by part
+	r, err = RequestFromReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\nHost: localhost\r\n" +
+			"Content-Type: multipart/form-data; boundary=xyz\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"3d\r\n--xyz\r\nContent-Disposition: form-data; name=\"note\"\r\n\r\nhello\r\n\r\n" +
+			"9\r\n--xyz--\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 8,
+	})
+	require.NoError(t, err)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "note", part.FormName())
+	value, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(value))
+
+	// Test: Not a form
+	r, err = RequestFromReader(&chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}",
+		numBytesPerRead: 8,
+	})
+	require.NoError(t, err)
+	_, err = r.Form(form.DefaultLimits)
+	require.ErrorIs(t, err, form.ErrUnsupportedMediaType)
 }
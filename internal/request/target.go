@@ -0,0 +1,205 @@
+package request
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TargetForm is one of the four shapes a request target can take, see RFC
+// 9112 section 3.2.
+type TargetForm int
+
+const (
+	// ORIGIN_FORM is an absolute path with an optional query: /where?q=now
+	ORIGIN_FORM TargetForm = iota
+	// ABSOLUTE_FORM is a complete URI, as sent to proxies:
+	// http://www.example.org/pub/WWW/TheProject.html
+	ABSOLUTE_FORM
+	// AUTHORITY_FORM is the host and port to tunnel to, only used by
+	// CONNECT: www.example.com:80
+	AUTHORITY_FORM
+	// ASTERISK_FORM addresses the server as a whole, only used by OPTIONS: *
+	ASTERISK_FORM
+)
+
+var errInvalidTarget = errors.New("invalid request target")
+
+// Target is the parsed request target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set for the absolute-form only.
+	Scheme string
+	// Host is the authority of the absolute-form and authority-form,
+	// including the port if one was given.
+	Host string
+	// Path is the percent-decoded path, "*" for the asterisk-form and empty
+	// for the authority-form.
+	Path string
+	// RawPath is the path exactly as sent.
+	RawPath  string
+	RawQuery string
+	// Fragment is the percent-decoded fragment. Clients are not supposed to
+	// send one, but it is kept rather than mistaken for part of the path.
+	Fragment string
+}
+
+// ParseTarget parses the target of a request with the given method, accepting
+// the authority-form only for CONNECT and the asterisk-form only for OPTIONS.
+func ParseTarget(method string, raw string) (*Target, error) {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] <= ' ' || raw[i] >= 0x7f {
+			return nil, errInvalidTarget
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		if !validAuthority(raw, true) {
+			return nil, errInvalidTarget
+		}
+		return &Target{Form: AUTHORITY_FORM, Host: raw}, nil
+
+	case raw == "*":
+		if method != "OPTIONS" {
+			return nil, errInvalidTarget
+		}
+		return &Target{Form: ASTERISK_FORM, Path: "*", RawPath: "*"}, nil
+
+	case strings.HasPrefix(raw, "/"):
+		target := &Target{Form: ORIGIN_FORM}
+		if err := target.parsePathQuery(raw); err != nil {
+			return nil, err
+		}
+		return target, nil
+	}
+
+	scheme, rest, found := strings.Cut(raw, "://")
+	if !found || !validScheme(scheme) {
+		return nil, errInvalidTarget
+	}
+
+	host := rest
+	pathQuery := "/"
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host = rest[:i]
+		pathQuery = rest[i:]
+		if !strings.HasPrefix(pathQuery, "/") {
+			pathQuery = "/" + pathQuery
+		}
+	}
+	if !validAuthority(host, false) {
+		return nil, errInvalidTarget
+	}
+
+	target := &Target{
+		Form:   ABSOLUTE_FORM,
+		Scheme: strings.ToLower(scheme),
+		Host:   host,
+	}
+	if err := target.parsePathQuery(pathQuery); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+func (t *Target) parsePathQuery(raw string) error {
+	raw, fragment, _ := strings.Cut(raw, "#")
+	rawPath, rawQuery, _ := strings.Cut(raw, "?")
+
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return errInvalidTarget
+	}
+	// the query is only checked for well-formed escapes, its pairs are left
+	// to Request.Query
+	if !validEscapes(rawQuery) {
+		return errInvalidTarget
+	}
+	fragment, err = url.PathUnescape(fragment)
+	if err != nil {
+		return errInvalidTarget
+	}
+
+	t.Path = path
+	t.RawPath = rawPath
+	t.RawQuery = rawQuery
+	t.Fragment = fragment
+	return nil
+}
+
+// validEscapes checks that every % starts an escape of two hex digits.
+func validEscapes(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return false
+		}
+		i += 2
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// validScheme checks scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if i == 0 && !isAlpha {
+			return false
+		}
+		if !isAlpha && !(c >= '0' && c <= '9') && !strings.ContainsRune("+-.", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAuthority checks a host with an optional port, which is mandatory if
+// requirePort is set. User info is not allowed in request targets.
+func validAuthority(authority string, requirePort bool) bool {
+	if authority == "" || strings.ContainsAny(authority, "@/?#") {
+		return false
+	}
+
+	host := authority
+	port := ""
+	if strings.HasPrefix(authority, "[") {
+		end := strings.Index(authority, "]")
+		if end < 0 {
+			return false
+		}
+		host = authority[:end+1]
+		rest := authority[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return false
+			}
+			port = rest[1:]
+		}
+	} else if i := strings.LastIndex(authority, ":"); i >= 0 {
+		host = authority[:i]
+		port = authority[i+1:]
+		if port == "" {
+			return false
+		}
+	}
+
+	if host == "" || strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return false
+	}
+	if port == "" {
+		return !requirePort
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535 && !strings.HasPrefix(port, "+")
+}
@@ -10,18 +10,6 @@ import (
 	"http-protocol-go/internal/headers"
 )
 
-type StatusCode int
-
-func (code StatusCode) Code() string {
-	return strconv.Itoa(int(code))
-}
-
-const (
-	OK                    StatusCode = 200
-	BAD_REQUEST           StatusCode = 400
-	INTERNAL_SERVER_ERROR StatusCode = 500
-)
-
 type WriterState int
 
 const (
@@ -29,114 +17,433 @@ const (
 	WriterHeaders
 	WriterBody
 	WriterTrailers
+	WriterDone
 )
 
 type Writer struct {
 	writer io.Writer
 	state  WriterState
+	close  bool
+	// err is the first error returned by the underlying writer, or the
+	// reason headers could not be written after the status line, after which
+	// nothing else is written
+	err error
+
+	statusCode  StatusCode
+	headers     *headers.Headers
+	contentLen  int64
+	chunked     bool
+	discardBody bool
+	// noBody is set for responses whose status forbids a body
+	noBody       bool
+	http10       bool
+	bytesWritten int64
+	headerHooks  []func(StatusCode, *headers.Headers)
+	// newFilter is set by SetBodyFilter and turned into filter once the
+	// headers are written
+	newFilter func(io.Writer) io.WriteCloser
+	filter    io.WriteCloser
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		writer: w,
-		state:  WriterStatusLine,
+		writer:     w,
+		state:      WriterStatusLine,
+		contentLen: -1,
 	}
 }
 
+func (w *Writer) write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.writer.Write(p)
+	if err != nil {
+		w.fail(err)
+	}
+	return n, err
+}
+
+// fail marks the response as broken: nothing else is written and the
+// connection is closed.
+func (w *Writer) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	w.close = true
+	return err
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason writes a status line with a custom reason phrase,
+// which clients are free to ignore. The phrase may be empty but must not
+// contain control characters other than tabs.
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
 	if w.state != WriterStatusLine {
 		return errors.New("wrong state to write status line")
 	}
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("invalid status code %d", statusCode)
+	}
+	if strings.ContainsFunc(reason, func(c rune) bool { return c != '\t' && (c < ' ' || c == 0x7f) }) {
+		return errors.New("invalid character in reason phrase")
+	}
 	defer func() { w.state = WriterHeaders }()
 
-	segments := []string{"HTTP/1.1"}
+	if w.err != nil {
+		return w.err
+	}
+
+	w.statusCode = statusCode
+	statusLine := fmt.Sprintf("HTTP/1.1 %s %s\r\n", statusCode.Code(), reason)
+
+	_, err := w.write([]byte(statusLine))
+	return err
+}
 
-	switch statusCode {
-	case OK:
-		segments = append(segments, OK.Code(), "OK")
-	case BAD_REQUEST:
-		segments = append(segments, BAD_REQUEST.Code(), "Bad Response")
-	case INTERNAL_SERVER_ERROR:
-		segments = append(segments, INTERNAL_SERVER_ERROR.Code(), "Internal Server Error")
-	default:
-		segments = append(segments, statusCode.Code())
+// WriteInformational writes an interim 1xx response, such as 100 Continue or
+// 103 Early Hints, ahead of the final status line. It can be called any number
+// of times before WriteStatusLine. HTTP/1.0 clients do not understand interim
+// responses, so nothing is sent to them.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.state != WriterStatusLine {
+		return errors.New("wrong state to write informational response")
+	}
+	// 101 Switching Protocols ends the HTTP exchange and is not interim
+	if statusCode < 100 || statusCode > 199 || statusCode == SWITCHING_PROTOCOLS {
+		return fmt.Errorf("invalid informational status code %d", statusCode)
+	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if w.http10 {
+		return nil
 	}
 
-	statusLine := strings.Join(segments, " ") + "\r\n"
+	block := fmt.Appendf(nil, "HTTP/1.1 %s %s\r\n", statusCode.Code(), StatusText(statusCode))
+	block = appendFields(block, h)
+	block = append(block, "\r\n"...)
 
-	_, err := w.writer.Write([]byte(statusLine))
+	_, err := w.write(block)
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	return headers.Headers{
-		"Content-Length": strconv.Itoa(contentLen),
-		"Connection":     "close",
-		"Content-Type":   "text/plain",
+// appendFields appends the header lines of h with canonically cased names.
+func appendFields(block []byte, h *headers.Headers) []byte {
+	for name, value := range h.All() {
+		block = fmt.Appendf(block, "%s: %s\r\n", headers.CanonicalName(name), value)
+	}
+	return block
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("Content-Length", strconv.Itoa(contentLen))
+	h.Set("Content-Type", "text/plain")
+	return h
+}
+
+// SetConnectionClose marks the connection to be closed once this response has
+// been written. WriteHeaders adds "Connection: close" unless the handler
+// already set a Connection header.
+func (w *Writer) SetConnectionClose() {
+	w.close = true
+}
+
+// ConnectionClose reports whether the connection has to be closed after this
+// response, either because it was requested or because the response has no
+// framing the client could use to find its end.
+func (w *Writer) ConnectionClose() bool {
+	return w.close
+}
+
+// DiscardBody makes the writer drop all body bytes, chunked framing and
+// trailers while still sending the status line and headers unchanged, as
+// needed to answer HEAD requests with the handler for GET.
+func (w *Writer) DiscardBody() {
+	w.discardBody = true
+}
+
+// SetHTTP10 adapts the response to an HTTP/1.0 client, which knows neither
+// chunked framing nor persistent connections by default: a chunked body is
+// sent as is and delimited by closing the connection, and a connection that
+// stays open is announced with "Connection: keep-alive".
+func (w *Writer) SetHTTP10() {
+	w.http10 = true
+}
+
+// StatusCode returns the status code of the response, or 0 if the status line
+// has not been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// Headers returns the headers sent with the response, or nil if they have not
+// been written yet.
+func (w *Writer) Headers() *headers.Headers {
+	return w.headers
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// chunked framing.
+func (w *Writer) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+// OnWriteHeaders registers fn to be called right before the headers are
+// written. fn may modify the headers, which lets middleware add or rewrite
+// fields of responses produced by the handlers they wrap. Hooks run in the
+// order they were registered.
+func (w *Writer) OnWriteHeaders(fn func(statusCode StatusCode, h *headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, fn)
+}
+
+// SetBodyFilter makes every body byte pass through the writer returned by
+// filter, which writes the transformed body on to the connection. Since the
+// length of the result is unknown, Content-Length is dropped and the response
+// is sent chunked; closing the filter must flush what it still holds. It has
+// to be called before the headers are written, for example from a hook
+// registered with OnWriteHeaders.
+func (w *Writer) SetBodyFilter(filter func(w io.Writer) io.WriteCloser) error {
+	if w.state > WriterHeaders {
+		return errors.New("body filter set after headers were written")
 	}
+	w.newFilter = filter
+	return nil
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.state != WriterHeaders {
 		return errors.New("wrong state to write headers")
 	}
-	defer func() { w.state = WriterBody }()
+	// hooks and the body filter add fields, so nil needs a list to add to
+	if h == nil {
+		h = headers.NewHeaders()
+	}
 
-	for key, value := range h {
-		w.writer.Write(fmt.Appendf(nil, "%s: %s\r\n", key, value))
+	for _, hook := range w.headerHooks {
+		hook(w.statusCode, h)
 	}
-	w.writer.Write([]byte("\r\n"))
-	return nil
+	if w.newFilter != nil {
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+	}
+
+	// invalid headers are not written, and since the status line is already
+	// out the response cannot be completed without making up other ones
+	if err := h.Validate(); err != nil {
+		return w.fail(err)
+	}
+	transferEncoding, _ := h.Get("Transfer-Encoding")
+	chunked := strings.EqualFold(transferEncoding, "chunked")
+	contentLen := int64(-1)
+	if contentLenHeader, ok := h.Get("Content-Length"); ok && !chunked {
+		var err error
+		contentLen, err = strconv.ParseInt(contentLenHeader, 10, 64)
+		if err != nil || contentLen < 0 {
+			return w.fail(errors.New("invalid Content-Length header"))
+		}
+	}
+
+	// 1xx, 204 and 304 responses end after the headers, whatever framing
+	// fields they carry, see RFC 9112 section 6.3
+	noBody := w.statusCode < 200 || w.statusCode == NO_CONTENT || w.statusCode == NOT_MODIFIED
+
+	w.state = WriterBody
+	w.headers = h
+	w.noBody = noBody
+	w.chunked = chunked && !noBody
+	w.contentLen = contentLen
+	if w.newFilter != nil && !w.discardBody && !noBody {
+		w.filter = w.newFilter(chunkWriter{w})
+	}
+
+	connection, hasConnection := h.Get("Connection")
+	if hasConnection && strings.EqualFold(strings.TrimSpace(connection), "close") {
+		w.close = true
+	}
+
+	if w.chunked && w.http10 {
+		h.Del("Transfer-Encoding")
+		h.Del("Content-Length")
+		w.close = true
+	} else if !w.chunked && w.contentLen < 0 && !noBody && !w.discardBody {
+		// without framing the body ends when the connection closes
+		w.close = true
+	}
+
+	block := []byte{}
+	block = appendFields(block, h)
+	if w.close && !hasConnection {
+		block = append(block, "Connection: close\r\n"...)
+	} else if w.http10 && !hasConnection {
+		block = append(block, "Connection: keep-alive\r\n"...)
+	}
+	block = append(block, "\r\n"...)
+
+	_, err := w.write(block)
+	return err
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != WriterBody {
 		return 0, errors.New("wrong state to write body")
 	}
-	return w.writer.Write(p)
+	if w.noBody {
+		return 0, fmt.Errorf("status %d does not allow a body", w.statusCode)
+	}
+	if w.contentLen >= 0 && w.bytesWritten+int64(len(p)) > w.contentLen {
+		return 0, errors.New("body longer than Content-Length")
+	}
+	if w.discardBody {
+		w.bytesWritten += int64(len(p))
+		return len(p), nil
+	}
+	if w.filter != nil {
+		n, err := w.filter.Write(p)
+		w.bytesWritten += int64(n)
+		return n, err
+	}
+	n, err := w.write(p)
+	w.bytesWritten += int64(n)
+	return n, err
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.state != WriterBody {
 		return 0, errors.New("wrong state to write chunked body")
 	}
+	if w.noBody {
+		return 0, fmt.Errorf("status %d does not allow a body", w.statusCode)
+	}
+	if w.discardBody {
+		w.bytesWritten += int64(len(p))
+		return len(p), nil
+	}
+
+	var n int
+	var err error
+	if w.filter != nil {
+		n, err = w.filter.Write(p)
+	} else {
+		n, err = w.writeChunk(p)
+	}
+	w.bytesWritten += int64(n)
+	return n, err
+}
 
-	if _, err := fmt.Fprintf(w.writer, "%x\r\n", len(p)); err != nil {
+// writeChunk frames p as one chunk, or writes it as is to HTTP/1.0 clients.
+// An empty p writes nothing, since an empty chunk would end the body.
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.http10 {
+		return w.write(p)
+	}
+
+	if _, err := w.write(fmt.Appendf(nil, "%x\r\n", len(p))); err != nil {
 		return 0, err
 	}
 
-	n, err := w.writer.Write(p)
+	n, err := w.write(p)
 	if err != nil {
 		return n, err
 	}
 
-	if _, err := w.writer.Write([]byte("\r\n")); err != nil {
+	if _, err := w.write([]byte("\r\n")); err != nil {
 		return n, err
 	}
 
 	return n, nil
 }
 
+// chunkWriter is the destination of a body filter.
+type chunkWriter struct {
+	w *Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	return cw.w.writeChunk(p)
+}
+
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.state != WriterBody {
 		return 0, errors.New("wrong state to write chunked body done")
 	}
 	w.state = WriterTrailers
-	return fmt.Fprintf(w.writer, "0\r\n")
+	if w.discardBody || w.noBody {
+		return 0, nil
+	}
+	if w.filter != nil {
+		// flushes whatever the filter still holds as the last chunks
+		if err := w.filter.Close(); err != nil {
+			return 0, err
+		}
+	}
+	if w.http10 {
+		return 0, nil
+	}
+	return w.write([]byte("0\r\n"))
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
 	if w.state != WriterTrailers {
 		return errors.New("wrong state to write trailers")
 	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	defer func() { w.state = WriterDone }()
+	if w.discardBody || w.noBody || w.http10 {
+		return nil
+	}
+
+	block := []byte{}
+	block = appendFields(block, h)
+	block = append(block, "\r\n"...)
+
+	_, err := w.write(block)
+	return err
+}
+
+// Finish completes a response the handler left unfinished: missing headers
+// are sent as an empty body and an open chunked body is terminated. It returns
+// an error if the response cannot be completed, in which case the connection
+// must not be reused.
+func (w *Writer) Finish() error {
+	if w.err != nil {
+		return w.err
+	}
 
-	for key, value := range h {
-		_, err := w.writer.Write(fmt.Appendf(nil, "%s: %s\r\n", key, value))
-		if err != nil {
-			return err
+	switch w.state {
+	case WriterStatusLine:
+		w.close = true
+		return errors.New("no response was written")
+
+	case WriterHeaders:
+		return w.WriteHeaders(GetDefaultHeaders(0))
+
+	case WriterBody:
+		if w.chunked {
+			if _, err := w.WriteChunkedBodyDone(); err != nil {
+				return err
+			}
+			return w.WriteTrailers(headers.NewHeaders())
+		}
+		if w.contentLen >= 0 && w.bytesWritten < w.contentLen && !w.discardBody && !w.noBody {
+			w.close = true
+			return fmt.Errorf("body shorter than Content-Length: wrote %d of %d bytes", w.bytesWritten, w.contentLen)
 		}
+		w.state = WriterDone
+		return nil
+
+	case WriterTrailers:
+		return w.WriteTrailers(headers.NewHeaders())
 	}
 
-	_, err := w.writer.Write([]byte("\r\n"))
-	return err
+	return nil
 }
@@ -0,0 +1,216 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/headers"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered reason phrases
+	for code, reason := range map[StatusCode]string{
+		OK:                              "OK",
+		BAD_REQUEST:                     "Bad Request",
+		NOT_FOUND:                       "Not Found",
+		REQUEST_HEADER_FIELDS_TOO_LARGE: "Request Header Fields Too Large",
+		HTTP_VERSION_NOT_SUPPORTED:      "HTTP Version Not Supported",
+	} {
+		buf := new(bytes.Buffer)
+		require.NoError(t, NewWriter(buf).WriteStatusLine(code))
+		assert.Equal(t, "HTTP/1.1 "+code.Code()+" "+reason+"\r\n", buf.String())
+	}
+
+	// Test: Unregistered code keeps the space before the empty reason
+	buf := new(bytes.Buffer)
+	require.NoError(t, NewWriter(buf).WriteStatusLine(599))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+
+	// Test: Custom reason phrase
+	buf = new(bytes.Buffer)
+	require.NoError(t, NewWriter(buf).WriteStatusLineWithReason(OK, "Totally Fine"))
+	assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", buf.String())
+
+	// Test: Reason phrase with line break
+	buf = new(bytes.Buffer)
+	require.Error(t, NewWriter(buf).WriteStatusLineWithReason(OK, "OK\r\nX-Injected: yes"))
+	assert.Equal(t, 0, buf.Len())
+
+	// Test: Status code out of range
+	buf = new(bytes.Buffer)
+	require.Error(t, NewWriter(buf).WriteStatusLine(42))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "Content Too Large", StatusText(CONTENT_TOO_LARGE))
+	assert.Equal(t, "Early Hints", StatusText(EARLY_HINTS))
+	assert.Equal(t, "", StatusText(299))
+}
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Interim responses precede the final one
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteInformational(CONTINUE, nil))
+	hints := GetDefaultHeaders(0)
+	hints.Del("Content-Length")
+	hints.Del("Content-Type")
+	hints.Set("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInformational(EARLY_HINTS, hints))
+	require.NoError(t, w.WriteStatusLine(OK))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\n", buf.String())
+
+	// Test: Only interim status codes
+	for _, code := range []StatusCode{SWITCHING_PROTOCOLS, OK, 99} {
+		require.Error(t, NewWriter(buf).WriteInformational(code, nil))
+	}
+
+	// Test: Not after the final status line
+	require.Error(t, w.WriteInformational(CONTINUE, nil))
+
+	// Test: Not sent to HTTP/1.0 clients
+	buf = new(bytes.Buffer)
+	w = NewWriter(buf)
+	w.SetHTTP10()
+	require.NoError(t, w.WriteInformational(CONTINUE, nil))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestWriteHeaders(t *testing.T) {
+	// Test: Fields keep their order, repeats and get canonical names
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(OK))
+	h := GetDefaultHeaders(0)
+	h.Add("set-cookie", "a=1")
+	h.Add("X-REQUEST-ID", "42")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"X-Request-Id: 42\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestNoBodyStatus(t *testing.T) {
+	for _, code := range []StatusCode{NO_CONTENT, NOT_MODIFIED} {
+		// Test: No framing needed and no body allowed
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		require.NoError(t, w.WriteStatusLine(code))
+		h := headers.NewHeaders()
+		if code == NOT_MODIFIED {
+			h.Set("Content-Length", "42")
+		}
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteBody([]byte("x"))
+		require.Error(t, err)
+		_, err = w.WriteChunkedBody([]byte("x"))
+		require.Error(t, err)
+		require.NoError(t, w.Finish())
+		assert.False(t, w.ConnectionClose())
+		assert.NotContains(t, buf.String(), "Connection")
+	}
+
+	// Test: HEAD response without framing keeps the connection
+	w := NewWriter(new(bytes.Buffer))
+	w.DiscardBody()
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.Finish())
+	assert.False(t, w.ConnectionClose())
+}
+
+func TestWriteHeadersInjection(t *testing.T) {
+	// Test: Invalid value is not written and fails the response
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(FOUND))
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/next\r\nSet-Cookie: admin=1")
+	require.Error(t, w.WriteHeaders(h))
+	require.Error(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.Error(t, w.Finish())
+	assert.True(t, w.ConnectionClose())
+	assert.Equal(t, "HTTP/1.1 302 Found\r\n", buf.String())
+
+	// Test: Invalid trailers are not written
+	buf = new(bytes.Buffer)
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(OK))
+	h = GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := GetDefaultHeaders(0)
+	trailers.Set("X-Checksum", "abc\x00")
+	require.Error(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: Invalid informational headers are not written
+	buf = new(bytes.Buffer)
+	hints := GetDefaultHeaders(0)
+	hints.Set("Link", "</a>\n")
+	require.Error(t, NewWriter(buf).WriteInformational(EARLY_HINTS, hints))
+	assert.Equal(t, 0, buf.Len())
+}
+
+// prefixWriter is a body filter that prepends a marker to every write.
+type prefixWriter struct {
+	w      io.Writer
+	closed bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(append([]byte(">"), b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) Close() error {
+	p.closed = true
+	_, err := p.w.Write([]byte("!"))
+	return err
+}
+
+func TestBodyFilter(t *testing.T) {
+	// Test: Body goes through the filter with chunked framing
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	filter := &prefixWriter{}
+	w.OnWriteHeaders(func(_ StatusCode, h *headers.Headers) {
+		require.NoError(t, w.SetBodyFilter(func(out io.Writer) io.WriteCloser {
+			filter.w = out
+			return filter
+		}))
+	})
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteBody(nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, filter.closed)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"6\r\n>hello\r\n1\r\n>\r\n1\r\n!\r\n0\r\n\r\n", buf.String())
+	assert.Equal(t, int64(5), w.BytesWritten())
+
+	// Test: Not after the headers
+	require.Error(t, w.SetBodyFilter(func(out io.Writer) io.WriteCloser { return nil }))
+}
@@ -0,0 +1,299 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+	"http-protocol-go/internal/server"
+)
+
+type segmentKind int
+
+const (
+	literalSegment segmentKind = iota
+	paramSegment
+	wildcardSegment
+)
+
+type segment struct {
+	kind segmentKind
+	// value is the literal text or the name of the captured parameter
+	value string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+// ServeMux dispatches requests to the handler whose pattern matches the
+// request path.
+//
+// A pattern is a path made of "/"-separated segments. A segment is either
+// literal text, "{name}" matching exactly one non-empty segment, or, as the
+// last segment only, "{name...}" or "*" matching the rest of the path. A
+// pattern ending in "/" only matches paths ending in "/". When several
+// patterns match, the one with literal segments furthest to the left wins.
+type ServeMux struct {
+	routes []*route
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers handler for requests with the given method whose path
+// matches pattern. An empty method matches every method. Handle panics if the
+// pattern is malformed or already registered for the method.
+func (m *ServeMux) Handle(method string, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: pattern %q: %v", pattern, err))
+	}
+
+	for _, r := range m.routes {
+		if r.method == method && r.pattern == pattern {
+			panic(fmt.Sprintf("router: pattern %q already registered for method %q", pattern, method))
+		}
+	}
+
+	m.routes = append(m.routes, &route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("must start with /")
+	}
+
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	names := map[string]bool{}
+
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		switch {
+		case part == "*":
+			if !last {
+				return nil, fmt.Errorf("* must be the last segment")
+			}
+			segments = append(segments, segment{kind: wildcardSegment})
+
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			kind := paramSegment
+			if strings.HasSuffix(name, "...") {
+				if !last {
+					return nil, fmt.Errorf("{%s} must be the last segment", name)
+				}
+				name = strings.TrimSuffix(name, "...")
+				kind = wildcardSegment
+			}
+			if name == "" {
+				return nil, fmt.Errorf("empty parameter name")
+			}
+			if names[name] {
+				return nil, fmt.Errorf("duplicate parameter %q", name)
+			}
+			names[name] = true
+			segments = append(segments, segment{kind: kind, value: name})
+
+		case strings.ContainsAny(part, "{}"):
+			return nil, fmt.Errorf("bad parameter segment %q", part)
+
+		default:
+			segments = append(segments, segment{kind: literalSegment, value: part})
+		}
+	}
+
+	return segments, nil
+}
+
+// match reports whether path matches the route and returns the captured
+// parameters.
+func (r *route) match(path []string) (map[string]string, bool) {
+	params := map[string]string{}
+
+	for i, seg := range r.segments {
+		if i >= len(path) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case literalSegment:
+			if path[i] != seg.value {
+				return nil, false
+			}
+		case paramSegment:
+			if path[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = path[i]
+		case wildcardSegment:
+			if seg.value != "" {
+				params[seg.value] = strings.Join(path[i:], "/")
+			}
+			return params, true
+		}
+	}
+
+	if len(path) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific reports whether r should win over other when both match a
+// request with method.
+func (r *route) moreSpecific(other *route, method string) bool {
+	for i := range min(len(r.segments), len(other.segments)) {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind < other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.methodRank(method) > other.methodRank(method)
+}
+
+// methodRank orders how closely the route method fits the request method: an
+// exact match beats a GET route serving HEAD, which beats a catch-all route.
+func (r *route) methodRank(method string) int {
+	switch {
+	case r.method == method:
+		return 3
+	case r.method == "GET" && method == "HEAD":
+		return 2
+	case r.method == "":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// lookup finds the best route for method and the raw, still percent-encoded
+// path. When no route accepts the method, it returns the methods the path is
+// registered for instead.
+func (m *ServeMux) lookup(method string, rawPath string) (*route, map[string]string, []string) {
+	var best *route
+	var bestParams map[string]string
+	var allowed []string
+
+	if !strings.HasPrefix(rawPath, "/") {
+		return nil, nil, nil
+	}
+
+	// segments are split before decoding, so that an encoded "/" stays
+	// within its segment
+	segments := strings.Split(rawPath[1:], "/")
+	for i, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, nil, nil
+		}
+		segments[i] = decoded
+	}
+
+	for _, r := range m.routes {
+		params, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+
+		if r.methodRank(method) == 0 {
+			allowed = append(allowed, r.method)
+			if r.method == "GET" {
+				allowed = append(allowed, "HEAD")
+			}
+			continue
+		}
+
+		if best == nil || r.moreSpecific(best, method) {
+			best = r
+			bestParams = params
+		}
+	}
+
+	slices.Sort(allowed)
+	return best, bestParams, slices.Compact(allowed)
+}
+
+// Serve is a server.Handler dispatching the request to the matching route.
+func (m *ServeMux) Serve(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	path := req.Target.RawPath
+
+	r, params, allowed := m.lookup(method, path)
+	if r != nil {
+		for name, value := range params {
+			req.SetPathValue(name, value)
+		}
+		r.handler(w, req)
+		return
+	}
+
+	if len(allowed) > 0 {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Allow", strings.Join(allowed, ", "))
+		writeResponse(w, response.METHOD_NOT_ALLOWED, h, "Method Not Allowed\n")
+		return
+	}
+
+	if target, ok := m.redirectTarget(method, path); ok {
+		if req.Target.RawQuery != "" {
+			target += "?" + req.Target.RawQuery
+		}
+
+		// 301 lets clients turn a POST into a GET, 308 does not
+		statusCode := response.PERMANENT_REDIRECT
+		if method == "GET" || method == "HEAD" {
+			statusCode = response.MOVED_PERMANENTLY
+		}
+
+		h := response.GetDefaultHeaders(0)
+		h.Set("Location", target)
+		writeResponse(w, statusCode, h, "")
+		return
+	}
+
+	writeResponse(w, response.NOT_FOUND, response.GetDefaultHeaders(0), "Not Found\n")
+}
+
+// redirectTarget returns the raw path with its trailing slash added or removed, if
+// that variant would be routed. Authority-form and asterisk-form targets have
+// no path to fix and are never redirected.
+func (m *ServeMux) redirectTarget(method string, path string) (string, bool) {
+	var target string
+	switch {
+	case !strings.HasPrefix(path, "/"), path == "/":
+		return "", false
+	case strings.HasSuffix(path, "/"):
+		target = strings.TrimSuffix(path, "/")
+	default:
+		target = path + "/"
+	}
+
+	r, _, _ := m.lookup(method, target)
+	return target, r != nil
+}
+
+func writeResponse(w *response.Writer, statusCode response.StatusCode, h *headers.Headers, body string) {
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+	w.WriteBody([]byte(body))
+}
@@ -0,0 +1,143 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+func serve(t *testing.T, mux *ServeMux, method string, target string) string {
+	t.Helper()
+
+	parsed, err := request.ParseTarget(method, target)
+	require.NoError(t, err)
+
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, Target: target, HttpVersion: "1.1"},
+		Target:      parsed,
+		Headers:     headers.NewHeaders(),
+	}
+
+	buf := new(bytes.Buffer)
+	mux.Serve(response.NewWriter(buf), req)
+	return buf.String()
+}
+
+func reply(body string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := body
+		for _, name := range []string{"id", "path"} {
+			if value := req.PathValue(name); value != "" {
+				body += " " + name + "=" + value
+			}
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestServeMuxRouting(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("GET", "/", reply("root"))
+	mux.Handle("GET", "/users/{id}", reply("user"))
+	mux.Handle("GET", "/users/me", reply("me"))
+	mux.Handle("DELETE", "/users/{id}", reply("deleted"))
+	mux.Handle("", "/files/{path...}", reply("file"))
+	mux.Handle("GET", "/static/*", reply("static"))
+	mux.Handle("HEAD", "/static/*", reply("static head"))
+
+	// Test: Root
+	out := serve(t, mux, "GET", "/")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nroot"))
+
+	// Test: Path parameter
+	out = serve(t, mux, "GET", "/users/42?verbose=1")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nuser id=42"))
+
+	// Test: Literal segment wins over parameter
+	out = serve(t, mux, "GET", "/users/me")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nme"))
+
+	// Test: Method specific route
+	out = serve(t, mux, "DELETE", "/users/42")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\ndeleted id=42"))
+
+	// Test: HEAD is served by the GET route
+	out = serve(t, mux, "HEAD", "/users/42")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nuser id=42"))
+
+	// Test: Named wildcard matches any method and the rest of the path
+	out = serve(t, mux, "POST", "/files/a/b/c.txt")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nfile path=a/b/c.txt"))
+
+	// Test: Parameters are percent-decoded, encoded slashes stay inside
+	out = serve(t, mux, "GET", "/users/a%2Fb%20c")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nuser id=a/b c"))
+
+	// Test: Anonymous wildcard
+	out = serve(t, mux, "GET", "/static/css/site.css")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nstatic"))
+
+	// Test: Explicit HEAD route wins over the GET one
+	out = serve(t, mux, "HEAD", "/static/css/site.css")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nstatic head"))
+}
+
+func TestServeMuxErrors(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("GET", "/users/{id}", reply("user"))
+	mux.Handle("DELETE", "/users/{id}", reply("deleted"))
+	mux.Handle("GET", "/docs/", reply("docs"))
+	mux.Handle("POST", "/upload", reply("upload"))
+
+	// Test: Not found
+	out := serve(t, mux, "GET", "/nope")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Method not allowed lists allowed methods
+	out = serve(t, mux, "PUT", "/users/42")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD\r\n")
+
+	// Test: Missing trailing slash redirects
+	out = serve(t, mux, "GET", "/docs?page=2")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, out, "Location: /docs/?page=2\r\n")
+
+	// Test: Extra trailing slash redirects keeping the method
+	out = serve(t, mux, "POST", "/upload/")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 308 Permanent Redirect\r\n"))
+	assert.Contains(t, out, "Location: /upload\r\n")
+
+	// Test: Parameters do not match empty segments
+	out = serve(t, mux, "GET", "/users/")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Targets without a path are not redirected
+	mux.Handle("", "/{path...}", reply("any"))
+	out = serve(t, mux, "CONNECT", "example.com:443")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+	out = serve(t, mux, "OPTIONS", "*")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+}
+
+func TestServeMuxBadPatterns(t *testing.T) {
+	mux := NewServeMux()
+	assert.Panics(t, func() { mux.Handle("GET", "users", reply("")) })
+	assert.Panics(t, func() { mux.Handle("GET", "/{path...}/edit", reply("")) })
+	assert.Panics(t, func() { mux.Handle("GET", "/*/edit", reply("")) })
+	assert.Panics(t, func() { mux.Handle("GET", "/{id}/{id}", reply("")) })
+	assert.Panics(t, func() { mux.Handle("GET", "/{}", reply("")) })
+
+	mux.Handle("GET", "/users", reply(""))
+	assert.Panics(t, func() { mux.Handle("GET", "/users", reply("")) })
+}
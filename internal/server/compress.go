@@ -0,0 +1,144 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/negotiate"
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+// Encoder returns a writer that compresses into w. Closing it has to flush
+// everything it still holds without closing w.
+type Encoder func(w io.Writer) io.WriteCloser
+
+// Coding is a content coding the Compress middleware can apply.
+type Coding struct {
+	// Name is the token used in Accept-Encoding and Content-Encoding.
+	Name    string
+	Encoder Encoder
+}
+
+// DefaultCodings are the codings the standard library provides. Other
+// codings such as zstd can be plugged in by listing them in
+// CompressOptions.Codings along with these.
+var DefaultCodings = []Coding{
+	{Name: "gzip", Encoder: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+	// "deflate" is the zlib format, not a raw deflate stream
+	{Name: "deflate", Encoder: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+}
+
+// defaultCompressMinSize is the smallest body worth compressing when the
+// handler announces its length.
+const defaultCompressMinSize = 1024
+
+// incompressibleTypes are media types whose content is compressed already.
+// Whole top-level types end in "/".
+var incompressibleTypes = []string{
+	"image/", "audio/", "video/",
+	"application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2",
+	"application/pdf", "font/woff", "font/woff2",
+}
+
+// compressibleImages are image types stored as text.
+var compressibleImages = []string{"image/svg+xml", "image/x-icon", "image/bmp"}
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// Codings lists the codings to offer in order of preference, which
+	// decides between codings the client accepts equally. Nil means
+	// DefaultCodings.
+	Codings []Coding
+	// MinSize is the smallest Content-Length compressed. Zero means 1024,
+	// negative compresses every body. Bodies of unknown length are always
+	// compressed.
+	MinSize int64
+}
+
+// Compress compresses response bodies with the best coding the client accepts
+// according to Accept-Encoding. Responses that already have a
+// Content-Encoding, carry compressed media types, are too small, or have no
+// body are sent as they are. Compressed responses are sent chunked, and every
+// response that could have been compressed carries "Vary: Accept-Encoding".
+func Compress(opts CompressOptions) Middleware {
+	codings := opts.Codings
+	if codings == nil {
+		codings = DefaultCodings
+	}
+	minSize := opts.MinSize
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+
+	offers := make([]string, 0, len(codings)+1)
+	for _, c := range codings {
+		offers = append(offers, c.Name)
+	}
+	offers = append(offers, "identity")
+
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.OnWriteHeaders(func(statusCode response.StatusCode, h *headers.Headers) {
+				if !compressible(statusCode, h, minSize) {
+					return
+				}
+				negotiate.Vary(h, "Accept-Encoding")
+
+				name, ok := negotiate.Encoding(req.Headers, offers)
+				if !ok || name == "identity" {
+					return
+				}
+				i := slices.IndexFunc(codings, func(c Coding) bool { return c.Name == name })
+				encoder := codings[i].Encoder
+
+				h.Set("Content-Encoding", name)
+				// the compressed representation is not byte for byte the
+				// same as the one a strong validator was computed for
+				if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+					h.Set("ETag", "W/"+etag)
+				}
+				w.SetBodyFilter(func(w io.Writer) io.WriteCloser { return encoder(w) })
+			})
+			next(w, req)
+		}
+	}
+}
+
+// compressible reports whether a response with these headers is worth
+// compressing.
+func compressible(statusCode response.StatusCode, h *headers.Headers, minSize int64) bool {
+	switch {
+	case statusCode < 200, statusCode == response.NO_CONTENT, statusCode == response.NOT_MODIFIED,
+		statusCode == response.PARTIAL_CONTENT:
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+
+	if contentLen, ok := h.Get("Content-Length"); ok {
+		if n, err := strconv.ParseInt(contentLen, 10, 64); err == nil && n < minSize {
+			return false
+		}
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType == ""
+	}
+	if slices.Contains(compressibleImages, mediaType) {
+		return true
+	}
+	return !slices.ContainsFunc(incompressibleTypes, func(t string) bool {
+		return mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)
+	})
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httputil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+// compressRoundTrip runs handler behind Compress for a GET request with the
+// given Accept-Encoding and returns the response head and raw body.
+func compressRoundTrip(t *testing.T, opts CompressOptions, acceptEncoding string, handler Handler) (string, []byte) {
+	t.Helper()
+
+	req := newRequest("GET", "/")
+	if acceptEncoding != "" {
+		req.Headers.Set("Accept-Encoding", acceptEncoding)
+	}
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf)
+	Chain(handler, Compress(opts))(w, req)
+	require.NoError(t, w.Finish())
+
+	head, body, found := strings.Cut(buf.String(), "\r\n\r\n")
+	require.True(t, found)
+	return head + "\r\n", []byte(body)
+}
+
+// dechunk removes chunked framing and the trailer section from body.
+func dechunk(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	data, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(body)))
+	require.NoError(t, err)
+	return data
+}
+
+func textHandler(body string, contentType string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		h := response.GetDefaultHeaders(len(body))
+		h.Set("Content-Type", contentType)
+		h.Set("ETag", `"v1"`)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestCompress(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+
+	// Test: gzip is preferred and the body is chunked
+	head, body := compressRoundTrip(t, CompressOptions{}, "deflate, gzip", textHandler(text, "text/plain"))
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Contains(t, head, "Etag: W/\"v1\"\r\n")
+	assert.NotContains(t, head, "Content-Length")
+	gz, err := gzip.NewReader(bytes.NewReader(dechunk(t, body)))
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(data))
+
+	// Test: deflate is the zlib format
+	head, body = compressRoundTrip(t, CompressOptions{}, "deflate", textHandler(text, "text/html; charset=utf-8"))
+	assert.Contains(t, head, "Content-Encoding: deflate\r\n")
+	zr, err := zlib.NewReader(bytes.NewReader(dechunk(t, body)))
+	require.NoError(t, err)
+	data, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(data))
+
+	// Test: Chunked handler output is compressed as well
+	head, body = compressRoundTrip(t, CompressOptions{}, "gzip", func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hello "))
+		w.WriteChunkedBody([]byte("world"))
+	})
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	gz, err = gzip.NewReader(bytes.NewReader(dechunk(t, body)))
+	require.NoError(t, err)
+	data, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	// Test: Client without Accept-Encoding gets identity with Vary
+	head, body = compressRoundTrip(t, CompressOptions{}, "", textHandler(text, "text/plain"))
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Equal(t, text, string(body))
+
+	// Test: Small bodies, compressed types and encoded bodies are skipped
+	for _, handler := range []Handler{
+		textHandler("tiny", "text/plain"),
+		textHandler(text, "image/png"),
+		textHandler(text, "application/zip"),
+		func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.OK)
+			h := response.GetDefaultHeaders(len(text))
+			h.Set("Content-Encoding", "br")
+			w.WriteHeaders(h)
+			w.WriteBody([]byte(text))
+		},
+		func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.NO_CONTENT)
+			h := response.GetDefaultHeaders(0)
+			w.WriteHeaders(h)
+		},
+	} {
+		head, _ = compressRoundTrip(t, CompressOptions{}, "gzip", handler)
+		assert.NotContains(t, head, "Content-Encoding: gzip")
+		assert.NotContains(t, head, "Vary")
+	}
+
+	// Test: Text-based images are compressed
+	head, _ = compressRoundTrip(t, CompressOptions{}, "gzip", textHandler(text, "image/svg+xml"))
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+
+	// Test: Pluggable coding
+	upper := Coding{Name: "x-upper", Encoder: func(w io.Writer) io.WriteCloser { return &upperWriter{w: w} }}
+	head, body = compressRoundTrip(t, CompressOptions{Codings: append([]Coding{upper}, DefaultCodings...), MinSize: -1},
+		"gzip, x-upper", textHandler("hello", "text/plain"))
+	assert.Contains(t, head, "Content-Encoding: x-upper\r\n")
+	assert.Equal(t, "HELLO", string(dechunk(t, body)))
+
+	// Test: Nil headers are compressed like empty ones
+	head, body = compressRoundTrip(t, CompressOptions{Codings: []Coding{upper}, MinSize: -1}, "x-upper",
+		func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.OK)
+			require.NoError(t, w.WriteHeaders(nil))
+			w.WriteChunkedBody([]byte("hello"))
+		})
+	assert.Contains(t, head, "Content-Encoding: x-upper\r\n")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Equal(t, "HELLO", string(dechunk(t, body)))
+}
+
+// upperWriter is a stand-in coding that upper-cases everything.
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u *upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+func (u *upperWriter) Close() error {
+	return nil
+}
+
+func TestCompressServer(t *testing.T) {
+	text := strings.Repeat("a", 2000)
+	handler := Chain(textHandler(text, "text/plain"), Compress(CompressOptions{}))
+
+	// Test: HEAD announces the coding without a body
+	out := roundTrip(t, handler, "HEAD / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "Content-Encoding: gzip\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: HTTP/1.0 clients get the compressed body delimited by close
+	out = roundTrip(t, handler, "GET / HTTP/1.0\r\nAccept-Encoding: gzip\r\n\r\n")
+	_, body, found := strings.Cut(out, "\r\n\r\n")
+	require.True(t, found)
+	assert.NotContains(t, out, "Transfer-Encoding")
+	gz, err := gzip.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(data))
+}
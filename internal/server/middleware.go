@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+// Middleware wraps a Handler with logic that runs around it.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with middlewares. The first middleware is the outermost
+// one, so it sees the request first and the finished response last.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Logger logs the method, target, status, body size and duration of every
+// request.
+func Logger(l *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			l.Printf("%s %s %d %dB %s",
+				req.RequestLine.Method,
+				req.RequestLine.Target,
+				w.StatusCode(),
+				w.BytesWritten(),
+				time.Since(start),
+			)
+		}
+	}
+}
+
+// Recover turns a panicking handler into a 500 response. If the handler had
+// already started its response, the connection is closed instead since the
+// client cannot be told about the failure anymore.
+func Recover(next Handler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				log.Printf("Panic while handling %s %s: %v", req.RequestLine.Method, req.RequestLine.Target, v)
+
+				w.SetConnectionClose()
+				if w.StatusCode() == 0 {
+					err := &HandlerError{
+						StatusCode: int(response.INTERNAL_SERVER_ERROR),
+						Message:    "Internal Server Error",
+					}
+					err.Write(w)
+				}
+			}
+		}()
+
+		next(w, req)
+	}
+}
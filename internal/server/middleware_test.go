@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+func newRequest(method string, target string) *request.Request {
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: method, Target: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" before")
+				next(w, req)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+
+	handler := Chain(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	}, trace("outer"), trace("inner"))
+
+	handler(response.NewWriter(new(bytes.Buffer)), newRequest("GET", "/"))
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+}
+
+func TestMiddlewareObservesResponse(t *testing.T) {
+	var statusCode response.StatusCode
+	var contentType string
+	var bytesWritten int64
+
+	observe := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.OnWriteHeaders(func(_ response.StatusCode, h *headers.Headers) {
+				h.Set("X-Request-Id", "abc")
+			})
+			next(w, req)
+			statusCode = w.StatusCode()
+			contentType, _ = w.Headers().Get("Content-Type")
+			bytesWritten = w.BytesWritten()
+		}
+	}
+
+	handler := Chain(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.BAD_REQUEST)
+		w.WriteHeaders(response.GetDefaultHeaders(5))
+		w.WriteBody([]byte("oops!"))
+	}, observe)
+
+	buf := new(bytes.Buffer)
+	handler(response.NewWriter(buf), newRequest("GET", "/"))
+
+	assert.Equal(t, response.BAD_REQUEST, statusCode)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, int64(5), bytesWritten)
+	assert.Contains(t, buf.String(), "X-Request-Id: abc\r\n")
+}
+
+func TestRecover(t *testing.T) {
+	// Test: Panic before the response started
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf)
+	Recover(func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})(w, newRequest("GET", "/"))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.True(t, w.ConnectionClose())
+
+	// Test: Panic after the response started
+	buf = new(bytes.Buffer)
+	w = response.NewWriter(buf)
+	Recover(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		panic("boom")
+	})(w, newRequest("GET", "/"))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+	assert.True(t, w.ConnectionClose())
+}
@@ -1,13 +1,18 @@
 package server
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"http-protocol-go/internal/headers"
 	"http-protocol-go/internal/request"
 	"http-protocol-go/internal/response"
 )
@@ -22,49 +27,176 @@ func (he *HandlerError) Error() string {
 }
 
 func (he *HandlerError) Write(w *response.Writer) {
-	w.WriteStatusLine(response.BAD_REQUEST)
+	w.SetConnectionClose()
+	w.WriteStatusLine(response.StatusCode(he.StatusCode))
 	w.WriteHeaders(response.GetDefaultHeaders(len(he.Message)))
 	w.WriteBody([]byte(he.Message))
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// ErrServerClosed is returned by Serve and ListenAndServe once the server has
+// been closed or shut down.
+var ErrServerClosed = errors.New("server closed")
+
+// defaultIdleTimeout is how long a keep-alive connection may sit idle waiting
+// for the next request before the server closes it.
+const defaultIdleTimeout = 2 * time.Minute
+
+// defaultReadHeaderTimeout bounds how long a client may take to send the
+// request line and headers, so slow clients cannot hold connections forever.
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// shutdownPollInterval is how often Shutdown checks whether all connections
+// have gone idle.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// maxDrainBytes is how much of a request body the handler left unread is
+// discarded to keep the connection open for the next request.
+const maxDrainBytes = 256 << 10
+
+// acceptRetryDelay is how long Serve waits before accepting again after a
+// failed Accept.
+const acceptRetryDelay = 10 * time.Millisecond
+
+// ConnState is the state of a client connection, reported to
+// Server.ConnState.
+type ConnState int
+
+const (
+	// StateNew connections were just accepted and have not sent a request
+	// yet.
+	StateNew ConnState = iota
+	// StateActive connections are reading a request or writing its
+	// response.
+	StateActive
+	// StateIdle connections wait for the next request and can be closed
+	// without losing anything.
+	StateIdle
+	// StateClosed connections are closed. It is the last state reported.
+	StateClosed
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(c))
+	}
+}
+
+// Server holds the configuration of an HTTP server. Its fields must not be
+// changed once it has started serving. A negative timeout disables it.
 type Server struct {
-	listener net.Listener
-	closed   atomic.Bool
-	handler  Handler
+	// Addr is the TCP address ListenAndServe listens on, ":http" if empty.
+	Addr string
+	// Handler answers every request.
+	Handler Handler
+
+	// ReadHeaderTimeout limits reading the request line and headers, counted
+	// from the first byte of the request. Zero means 10 seconds.
+	ReadHeaderTimeout time.Duration
+	// ReadBodyTimeout limits reading the request body, counted from the end
+	// of the headers. Zero means no limit.
+	ReadBodyTimeout time.Duration
+	// WriteTimeout limits writing the response, counted from the end of the
+	// headers of the request. Zero means no limit.
+	WriteTimeout time.Duration
+	// IdleTimeout limits how long a keep-alive connection waits for the next
+	// request. Zero means 2 minutes.
+	IdleTimeout time.Duration
+
+	// Limits bounds the size of requests. A zero field takes its value from
+	// request.DefaultLimits, a negative one means no limit.
+	Limits request.Limits
+
+	// Logger, if set, receives a line for every response sent, including
+	// errors for requests that could not be read.
+	Logger *log.Logger
+	// ErrorLog receives errors accepting connections and writing responses.
+	// If nil, the standard logger of the log package is used.
+	ErrorLog *log.Logger
+
+	// TLSConfig, if set, makes the server speak HTTPS on every listener.
+	TLSConfig *tls.Config
+
+	// ConnState, if set, is called whenever a connection changes state.
+	ConnState func(conn net.Conn, state ConnState)
+
+	closed atomic.Bool
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]ConnState
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return nil, errors.New("failed to create server: " + err.Error())
+// ListenAndServe listens on s.Addr and serves connections until the server is
+// closed. It always returns a non-nil error.
+func (s *Server) ListenAndServe() error {
+	if s.closed.Load() {
+		return ErrServerClosed
 	}
 
-	server := &Server{
-		listener: list,
-		handler:  handler,
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
 	}
 
-	go server.listen()
-
-	return server, nil
+	list, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(list)
 }
 
-func (s *Server) Close() {
-	s.closed.Store(true)
-	s.listener.Close()
+// Serve accepts connections on list and serves each of them in its own
+// goroutine until the server is closed. If s.TLSConfig is set, connections
+// speak HTTPS. It always returns a non-nil error.
+func (s *Server) Serve(list net.Listener) error {
+	if s.TLSConfig != nil {
+		list = tls.NewListener(list, s.tlsConfig())
+	}
+	return s.serveListener(list)
 }
 
-func (s *Server) listen() {
+func (s *Server) serveListener(list net.Listener) error {
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		list.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]struct{}{}
+	}
+	s.listeners[list] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, list)
+		s.mu.Unlock()
+	}()
+
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := list.Accept()
 		if err != nil {
 			if s.closed.Load() {
-				return
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
 			}
 
-			log.Printf("Error while accepting connection: %v", err)
+			s.logf("Error while accepting connection: %v", err)
+			time.Sleep(acceptRetryDelay)
 			continue
 		}
 
@@ -72,27 +204,428 @@ func (s *Server) listen() {
 	}
 }
 
+// Close stops accepting connections and closes all open ones right away,
+// cutting off requests that are still being handled.
+func (s *Server) Close() {
+	s.closed.Store(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeListeners()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for active
+// requests to complete, closing their connections as they finish. It returns
+// nil once every connection is closed, or the context error if ctx expires
+// first, in which case the remaining connections are left running.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+
+	s.mu.Lock()
+	s.closeListeners()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeListeners closes every listener being served. s.mu must be held.
+func (s *Server) closeListeners() {
+	for list := range s.listeners {
+		list.Close()
+		delete(s.listeners, list)
+	}
+}
+
+// closeIdleConns closes all connections that are not in the middle of a
+// request and reports whether no connections are left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state != StateActive {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// setConnState records the state of conn. It reports false if the server is
+// shutting down and the connection should not go on.
+func (s *Server) setConnState(conn net.Conn, state ConnState) bool {
+	s.mu.Lock()
+	_, tracked := s.conns[conn]
+	if !tracked && (state != StateNew || s.closed.Load()) {
+		s.mu.Unlock()
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]ConnState{}
+	}
+	s.conns[conn] = state
+	s.mu.Unlock()
+
+	if s.ConnState != nil {
+		s.ConnState(conn, state)
+	}
+	return true
+}
+
+// closeConn closes conn and stops tracking it.
+func (s *Server) closeConn(conn net.Conn) {
+	conn.Close()
+
+	// report before forgetting the connection, so that Shutdown does not
+	// return ahead of the hook
+	if s.ConnState != nil {
+		s.ConnState(conn, StateClosed)
+	}
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// logRequest writes the line for a request to s.Logger once its response has
+// been sent. req is nil for a request that could not be parsed.
+func (s *Server) logRequest(req *request.Request, w *response.Writer, start time.Time) {
+	if s.Logger == nil {
+		return
+	}
+	method, target := "-", "-"
+	if req != nil {
+		method, target = req.RequestLine.Method, req.RequestLine.Target
+	}
+	s.Logger.Printf("%s %s %d %dB %s", method, target, w.StatusCode(), w.BytesWritten(), time.Since(start))
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout == 0 {
+		return defaultReadHeaderTimeout
+	}
+	return s.ReadHeaderTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout == 0 {
+		return defaultIdleTimeout
+	}
+	return s.IdleTimeout
+}
+
+func (s *Server) limits() request.Limits {
+	limits := s.Limits
+	defaults := request.DefaultLimits
+	limits.MaxRequestLineBytes = limit(limits.MaxRequestLineBytes, defaults.MaxRequestLineBytes)
+	limits.MaxHeaderBytes = limit(limits.MaxHeaderBytes, defaults.MaxHeaderBytes)
+	limits.MaxHeaderCount = limit(limits.MaxHeaderCount, defaults.MaxHeaderCount)
+	limits.MaxBodyBytes = limit(limits.MaxBodyBytes, defaults.MaxBodyBytes)
+	return limits
+}
+
+// limit turns a configured limit into one for the request package, where zero
+// means no limit: zero takes the default and a negative value means no limit.
+func limit[T int | int64](configured T, def T) T {
+	switch {
+	case configured == 0:
+		return def
+	case configured < 0:
+		return 0
+	default:
+		return configured
+	}
+}
+
+func notImplemented(w *response.Writer, req *request.Request) {
+	err := &HandlerError{
+		StatusCode: int(response.NOT_IMPLEMENTED),
+		Message:    "method not implemented",
+	}
+	err.Write(w)
+}
+
+func expectationFailed(w *response.Writer, req *request.Request) {
+	err := &HandlerError{
+		StatusCode: int(response.EXPECTATION_FAILED),
+		Message:    "expectation not supported",
+	}
+	err.Write(w)
+}
+
+// requestError describes why a request could not be read.
+func requestError(err error) *HandlerError {
+	switch {
+	case isTimeout(err):
+		return &HandlerError{StatusCode: int(response.REQUEST_TIMEOUT), Message: "request not received in time"}
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return &HandlerError{StatusCode: int(response.URI_TOO_LONG), Message: err.Error()}
+	case errors.Is(err, request.ErrHeadersTooLarge):
+		return &HandlerError{StatusCode: int(response.REQUEST_HEADER_FIELDS_TOO_LARGE), Message: err.Error()}
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return &HandlerError{StatusCode: int(response.CONTENT_TOO_LARGE), Message: err.Error()}
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return &HandlerError{StatusCode: int(response.NOT_IMPLEMENTED), Message: err.Error()}
+	case errors.Is(err, request.ErrVersionNotSupported):
+		return &HandlerError{StatusCode: int(response.HTTP_VERSION_NOT_SUPPORTED), Message: err.Error()}
+	default:
+		return &HandlerError{StatusCode: int(response.BAD_REQUEST), Message: err.Error()}
+	}
+}
+
+// deadline turns a timeout into a deadline, where zero or less means none.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// connReader switches the read deadline of a connection from the idle timeout
+// to the header timeout as soon as the first byte of a request arrives, and
+// calls onStart then. If onStart returns false, the connection has been given
+// up on and the request is not read any further.
+type connReader struct {
+	conn          net.Conn
+	headerTimeout time.Duration
+	onStart       func() bool
+	started       bool
+	startedAt     time.Time
+	stopped       bool
+}
+
+func (cr *connReader) Read(p []byte) (int, error) {
+	if cr.stopped {
+		return 0, net.ErrClosed
+	}
+	n, err := cr.conn.Read(p)
+	if n > 0 && !cr.started && !cr.start() {
+		return 0, net.ErrClosed
+	}
+	return n, err
+}
+
+func (cr *connReader) start() bool {
+	cr.started = true
+	cr.startedAt = time.Now()
+	cr.conn.SetReadDeadline(deadline(cr.headerTimeout))
+	if !cr.onStart() {
+		cr.stopped = true
+	}
+	return !cr.stopped
+}
+
+// continueReader sends 100 Continue on the first read of a body the client
+// holds back until it is asked for it. A handler that answers without reading
+// the body never sends it.
+type continueReader struct {
+	io.ReadCloser
+	w    *response.Writer
+	sent bool
+}
+
+func (cr *continueReader) Read(p []byte) (int, error) {
+	if !cr.sent {
+		cr.sent = true
+		if cr.w.StatusCode() == 0 {
+			if err := cr.w.WriteInformational(response.CONTINUE, nil); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return cr.ReadCloser.Read(p)
+}
+
+// bodyReader remembers the last error seen while reading a request body.
+type bodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (br *bodyReader) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		br.err = err
+	}
+	return n, err
+}
+
 func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+	defer s.closeConn(conn)
 
+	if !s.setConnState(conn, StateNew) {
+		return
+	}
+
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn.SetDeadline(deadline(s.readHeaderTimeout()))
+		if err := tlsConn.Handshake(); err != nil {
+			s.logf("TLS handshake error from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		conn.SetDeadline(time.Time{})
+
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
+	// a connection counts as active from the first byte of a request, so
+	// that Shutdown does not cut off a request that is still arriving
+	reader := &connReader{
+		conn:          conn,
+		headerTimeout: s.readHeaderTimeout(),
+		onStart:       func() bool { return s.setConnState(conn, StateActive) },
+	}
+	requests := request.NewReader(reader, s.limits())
+
+	// requests are served one after the other, so responses to pipelined
+	// requests go out in the order the requests came in
+	for {
+		reader.started = false
+		conn.SetReadDeadline(deadline(s.idleTimeout()))
+		// a pipelined request may already be buffered
+		if requests.Buffered() > 0 && !reader.start() {
+			return
+		}
+
+		req, reqErr := requests.ReadRequest()
+		if reqErr != nil {
+			if errors.Is(reqErr, io.EOF) || (isTimeout(reqErr) && !reader.started) || reader.stopped {
+				return
+			}
+
+			err := requestError(reqErr)
+			conn.SetWriteDeadline(deadline(s.WriteTimeout))
+			w := response.NewWriter(conn)
+			err.Write(w)
+			s.logRequest(nil, w, reader.startedAt)
+			return
+		}
+
+		req.TLS = tlsState
+
+		conn.SetReadDeadline(deadline(s.ReadBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.WriteTimeout))
+
+		if !s.serve(conn, req, reader.startedAt) || s.closed.Load() {
+			return
+		}
+		if !s.setConnState(conn, StateIdle) {
+			return
+		}
+	}
+}
+
+// serve runs the handler for a single request that started arriving at start
+// and reports whether the connection can be reused for another one.
+func (s *Server) serve(conn net.Conn, req *request.Request, start time.Time) bool {
 	w := response.NewWriter(conn)
+	if req.IsHTTP10() {
+		w.SetHTTP10()
+	}
+	if req.WantsClose() {
+		w.SetConnectionClose()
+	}
+	if req.RequestLine.Method == "HEAD" {
+		w.DiscardBody()
+	}
+
+	var expect *continueReader
+	if req.ExpectsContinue() && req.State != request.DONE {
+		expect = &continueReader{ReadCloser: req.Body, w: w}
+		req.Body = expect
+	}
 
-	req, reqErr := request.RequestFromReader(conn)
-	if reqErr != nil {
-		err := &HandlerError{
-			StatusCode: int(response.BAD_REQUEST),
-			Message:    reqErr.Error(),
+	w.OnWriteHeaders(func(response.StatusCode, *headers.Headers) {
+		// a client still waiting for 100 Continue may never send the body,
+		// so the connection cannot be reused
+		if s.closed.Load() || expect != nil && !expect.sent {
+			w.SetConnectionClose()
 		}
-		err.Write(w)
-		return
+	})
+	body := &bodyReader{ReadCloser: req.Body}
+	req.Body = body
+
+	handler := s.Handler
+	if handler == nil {
+		handler = func(w *response.Writer, req *request.Request) {}
+	}
+	if !req.IsStandardMethod() {
+		handler = notImplemented
+	} else if _, ok := req.Headers.Get("Expect"); ok && !req.IsHTTP10() && !req.ExpectsContinue() {
+		handler = expectationFailed
+	}
+	handler(w, req)
+
+	// a handler that writes nothing answers with an empty 200, unless it
+	// gave up because the body could not be read
+	if w.StatusCode() == 0 {
+		if body.err != nil {
+			requestError(body.err).Write(w)
+			s.logRequest(req, w, start)
+			return false
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+
+	err := w.Finish()
+	s.logRequest(req, w, start)
+	if err != nil {
+		s.logf("Error while writing response to %s: %v", conn.RemoteAddr(), err)
+		return false
 	}
 
-	// body := bytes.NewBuffer([]byte{})
-	body := new(bytes.Buffer)
+	// draining a body that was never asked for would wait on the client
+	if expect != nil && !expect.sent {
+		return false
+	}
+
+	if w.ConnectionClose() {
+		return false
+	}
 
-	s.handler(w, req)
+	// whatever the handler left unread has to be consumed before the next
+	// request can be parsed from the connection, unless there is so much of
+	// it that closing the connection is cheaper
+	if req.State != request.DONE {
+		n, err := io.CopyN(io.Discard, req.Body, maxDrainBytes+1)
+		if n > maxDrainBytes || err != nil && err != io.EOF {
+			return false
+		}
+	}
 
-	w.WriteStatusLine(response.OK)
-	w.WriteHeaders(response.GetDefaultHeaders(len(body.Bytes())))
-	w.WriteBody(body.Bytes())
+	return true
 }
@@ -0,0 +1,777 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/headers"
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+// roundTrip sends raw to a server running handler over an in-memory
+// connection and returns everything the server wrote until it closed the
+// connection.
+func roundTrip(t *testing.T, handler Handler, raw string) string {
+	t.Helper()
+	return roundTripServer(t, &Server{Handler: handler, IdleTimeout: time.Second}, raw)
+}
+
+func roundTripServer(t *testing.T, s *Server, raw string) string {
+	t.Helper()
+
+	client, conn := net.Pipe()
+	go s.handle(conn)
+
+	go func() {
+		client.Write([]byte(raw))
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	out, err := io.ReadAll(client)
+	if err != nil && !strings.Contains(err.Error(), "closed") {
+		require.NoError(t, err)
+	}
+	return string(out)
+}
+
+// readResponse reads a single response with a Content-Length body.
+func readResponse(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+
+	statusLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+
+	contentLen := 0
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			contentLen, err = strconv.Atoi(strings.TrimSpace(value))
+			require.NoError(t, err)
+		}
+	}
+
+	body := make([]byte, contentLen)
+	_, err = io.ReadFull(reader, body)
+	require.NoError(t, err)
+	return statusLine, string(body)
+}
+
+func TestKeepAlive(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body := req.RequestLine.Target
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{Handler: handler, IdleTimeout: time.Second}
+	go s.handle(conn)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+
+	for _, target := range []string{"/one", "/two"} {
+		_, err := client.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+
+		statusLine, body := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+		assert.Equal(t, target, body)
+	}
+
+	_, err := client.Write([]byte("GET /three HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	_, body := readResponse(t, reader)
+	assert.Equal(t, "/three", body)
+
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestKeepAliveNoContent(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method == "DELETE" {
+			w.WriteStatusLine(response.NO_CONTENT)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{Handler: handler, IdleTimeout: time.Second}
+	go s.handle(conn)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+
+	// Test: 204 without framing keeps the connection open
+	_, err := client.Write([]byte("DELETE /item HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	statusLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n", statusLine)
+	blank, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", blank)
+
+	_, err = client.Write([]byte("GET /item HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	statusLine, body := readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	assert.Equal(t, "ok", body)
+}
+
+func TestDefaultResponse(t *testing.T) {
+	// Test: Handler writes nothing
+	out := roundTrip(t, func(w *response.Writer, req *request.Request) {},
+		"GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Length: 0\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Handler writes a full response
+	out = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.BAD_REQUEST)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("no"))
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nno"))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Handler leaves a chunked body open
+	out = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hi"))
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "2\r\nhi\r\n0\r\n\r\n"))
+
+	// Test: Handler writes less than it announced
+	out = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		w.WriteBody([]byte("short"))
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+}
+
+func startServer(t *testing.T, handler Handler) (*Server, string) {
+	t.Helper()
+
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{Handler: handler, IdleTimeout: time.Minute}
+	go s.Serve(list)
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.listeners) == 1
+	}, 5*time.Second, time.Millisecond)
+	return s, list.Addr().String()
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Target == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+	})
+
+	// an idle keep-alive connection
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	idle.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = idle.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	idleReader := bufio.NewReader(idle)
+	readResponse(t, idleReader)
+
+	// a connection with a request in flight
+	active, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer active.Close()
+	active.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = active.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	// a connection with request headers still arriving
+	partial, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer partial.Close()
+	partial.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = partial.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		active := 0
+		for _, state := range s.conns {
+			if state == StateActive {
+				active++
+			}
+		}
+		return active == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Test: Shutdown gives up when the deadline passes
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	_, err = idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+
+	// Test: Request that was arriving during Shutdown is served
+	_, err = partial.Write([]byte("Host: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	partialReader := bufio.NewReader(partial)
+	statusLine, _ := readResponse(t, partialReader)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	_, err = partialReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Shutdown completes once the active request is done
+	done := make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	close(release)
+
+	activeReader := bufio.NewReader(active)
+	statusLine, body := readResponse(t, activeReader)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	assert.Equal(t, "ok", body)
+	assert.NoError(t, <-done)
+
+	_, err = activeReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestConnReaderStopped(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	defer conn.Close()
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+	// Test: Request on a connection given up on is not read
+	reader := &connReader{conn: conn, onStart: func() bool { return false }}
+	_, err := request.NewReader(reader, request.DefaultLimits).ReadRequest()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestTimeouts(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+
+	run := func(raw string) string {
+		client, conn := net.Pipe()
+		defer client.Close()
+		s := &Server{
+			ReadHeaderTimeout: 50 * time.Millisecond,
+			ReadBodyTimeout:   50 * time.Millisecond,
+			IdleTimeout:       50 * time.Millisecond,
+			Handler:           handler,
+		}
+		go s.handle(conn)
+
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		if raw != "" {
+			_, err := client.Write([]byte(raw))
+			require.NoError(t, err)
+		}
+		out, _ := io.ReadAll(client)
+		return string(out)
+	}
+
+	// Test: Idle connection is closed silently
+	assert.Equal(t, "", run(""))
+
+	// Test: Headers not finished in time
+	out := run("GET / HTTP/1.1\r\nHost: localhost\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 408 Request Timeout\r\n"))
+
+	// Test: Body not finished in time
+	out = run("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 408 Request Timeout\r\n"))
+
+	// Test: Complete request is served
+	out = run("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nhello"))
+}
+
+func TestLimits(t *testing.T) {
+	s := &Server{
+		IdleTimeout: time.Second,
+		Limits: request.Limits{
+			MaxRequestLineBytes: 32,
+			MaxHeaderBytes:      64,
+			MaxBodyBytes:        4,
+		},
+		Handler: func(w *response.Writer, req *request.Request) {
+			req.ReadBody()
+		},
+	}
+
+	// Test: Request line too long
+	out := roundTripServer(t, s, "GET /"+strings.Repeat("a", 64)+" HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 414 URI Too Long\r\n"))
+
+	// Test: Headers too large
+	out = roundTripServer(t, s, "GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 64)+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 431 Request Header Fields Too Large\r\n"))
+
+	// Test: Header value over the value limit
+	out = roundTrip(t, nil, "GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 100<<10)+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 431 Request Header Fields Too Large\r\n"))
+
+	// Test: Content-Length above the limit
+	out = roundTripServer(t, s, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Chunked body above the limit
+	out = roundTripServer(t, s, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"))
+}
+
+func TestLimitDefaults(t *testing.T) {
+	// Test: Unset fields keep their defaults
+	s := &Server{Limits: request.Limits{MaxBodyBytes: 1 << 20}}
+	limits := request.DefaultLimits
+	limits.MaxBodyBytes = 1 << 20
+	assert.Equal(t, limits, s.limits())
+
+	out := roundTripServer(t, s, "GET /"+strings.Repeat("a", 16<<10)+" HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 414 URI Too Long\r\n"))
+
+	// Test: Negative fields disable the limit
+	s = &Server{Limits: request.Limits{MaxRequestLineBytes: -1, MaxHeaderCount: -1}}
+	limits = request.DefaultLimits
+	limits.MaxRequestLineBytes = 0
+	limits.MaxHeaderCount = 0
+	assert.Equal(t, limits, s.limits())
+}
+
+func TestServeListener(t *testing.T) {
+	var states []ConnState
+	var mu sync.Mutex
+	logs := new(strings.Builder)
+
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.OK)
+			w.WriteHeaders(response.GetDefaultHeaders(2))
+			w.WriteBody([]byte("ok"))
+		},
+		Logger: log.New(logs, "", 0),
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+		},
+	}
+
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error)
+	go func() { served <- s.Serve(list) }()
+
+	conn, err := net.Dial("tcp", list.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	_, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "ok", body)
+	conn.Close()
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.ErrorIs(t, s.ListenAndServe(), ErrServerClosed)
+
+	mu.Lock()
+	assert.Equal(t, []ConnState{StateNew, StateActive, StateClosed}, states)
+	mu.Unlock()
+	assert.Contains(t, logs.String(), "GET /hello 200 2B")
+}
+
+func TestServeListeners(t *testing.T) {
+	s := &Server{}
+	served := make(chan error)
+	var addrs []string
+	for range 2 {
+		list, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrs = append(addrs, list.Addr().String())
+		go func() { served <- s.Serve(list) }()
+	}
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.listeners) == 2
+	}, 5*time.Second, time.Millisecond)
+
+	// Test: Close stops every listener
+	s.Close()
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	for _, addr := range addrs {
+		_, err := net.Dial("tcp", addr)
+		assert.Error(t, err)
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	logs := new(strings.Builder)
+	s := &Server{IdleTimeout: time.Second, Logger: log.New(logs, "", 0)}
+
+	// Test: Default response is logged as sent
+	roundTripServer(t, s, "GET /empty HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, logs.String(), "GET /empty 200 0B")
+
+	// Test: Unreadable request is logged
+	roundTripServer(t, s, "GET / HTTP/1.1\r\n\r\n")
+	assert.Contains(t, logs.String(), "- - 400 ")
+}
+
+func TestMethods(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body := req.RequestLine.Method
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+
+	// Test: Standard method reaches the handler
+	out := roundTrip(t, handler, "PATCH / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nPATCH"))
+
+	// Test: Unknown method is not implemented
+	out = roundTrip(t, handler, "BREW / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 501 Not Implemented\r\n"))
+
+	// Test: Malformed method is a bad request
+	out = roundTrip(t, handler, "BR@W / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+}
+
+func TestHead(t *testing.T) {
+	// Test: Fixed length body is dropped, Content-Length kept
+	out := roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(5))
+		w.WriteBody([]byte("hello"))
+	}, "HEAD / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: Chunked body, framing and trailers are dropped
+	out = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hello"))
+		w.WriteChunkedBodyDone()
+		w.WriteTrailers(response.GetDefaultHeaders(0))
+	}, "HEAD / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+	assert.NotContains(t, out, "hello")
+
+	// Test: Handler announcing a body without writing it keeps the connection
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{Handler: func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(5))
+	}}
+	go s.handle(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+	for range 2 {
+		_, err := client.Write([]byte("HEAD / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+		for line != "\r\n" {
+			line, err = reader.ReadString('\n')
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestHTTP10(t *testing.T) {
+	chunked := func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hello "))
+		w.WriteChunkedBody([]byte("world"))
+		w.WriteChunkedBodyDone()
+		w.WriteTrailers(response.GetDefaultHeaders(0))
+	}
+
+	// Test: Chunked body is sent unframed and ends with the connection
+	out := roundTrip(t, chunked, "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\nGET / HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, out, "Transfer-Encoding")
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nhello world"))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Connection is closed by default
+	out = roundTrip(t, nil, "GET / HTTP/1.0\r\n\r\nGET / HTTP/1.0\r\n\r\n")
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Keep-alive is opt-in and announced
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{IdleTimeout: time.Second}
+	go s.handle(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+	for range 2 {
+		_, err := client.Write([]byte("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+		var connection string
+		for line := ""; line != "\r\n"; {
+			line, err = reader.ReadString('\n')
+			require.NoError(t, err)
+			if value, ok := strings.CutPrefix(line, "Connection: "); ok {
+				connection = value
+			}
+		}
+		assert.Equal(t, "keep-alive\r\n", connection)
+	}
+
+	// Test: Other versions are not supported
+	out = roundTrip(t, nil, "GET / HTTP/2.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 505 HTTP Version Not Supported\r\n"))
+
+	// Test: Malformed version is a bad request
+	out = roundTrip(t, nil, "GET / XHTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+}
+
+func TestSmuggling(t *testing.T) {
+	// Test: Ambiguous framing is rejected and the connection closed
+	out := roundTrip(t, nil, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nGET /smuggled HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Duplicate Host is a bad request
+	out = roundTrip(t, nil, "GET / HTTP/1.1\r\nHost: localhost\r\nHost: evil.example\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+
+	// Test: Unknown transfer coding is not implemented
+	out = roundTrip(t, nil, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip, chunked\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 501 Not Implemented\r\n"))
+}
+
+func TestExpectContinue(t *testing.T) {
+	echo := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+
+	// Test: 100 Continue is sent when the handler reads the body
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{Handler: echo, IdleTimeout: time.Second}
+	go s.handle(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+
+	_, err := client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+	statusLine, body := readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	assert.Equal(t, "hello", body)
+
+	// Test: Handler rejecting the request without reading the body
+	out := roundTrip(t, func(w *response.Writer, req *request.Request) {
+		err := &HandlerError{StatusCode: int(response.CONTENT_TOO_LARGE), Message: "too large"}
+		err.Write(w)
+	}, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.NotContains(t, out, "100 Continue")
+
+	// Test: Unanswered expectation closes the connection
+	out = roundTrip(t, nil, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Connection: close\r\n")
+
+	// Test: Body over the limit is rejected before it is sent
+	out = roundTripServer(t, &Server{Limits: request.Limits{MaxBodyBytes: 4}},
+		"POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Unknown expectation fails
+	out = roundTrip(t, echo, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 200-ok\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 417 Expectation Failed\r\n"))
+
+	// Test: HTTP/1.0 clients get no interim response
+	out = roundTrip(t, echo, "POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "hello"))
+}
+
+func TestPipelining(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		body = append([]byte(req.RequestLine.Target), body...)
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{Handler: handler, IdleTimeout: time.Second}
+	go s.handle(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// all requests go out before any response is read
+	go client.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"POST /two HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\n:abc" +
+		"POST /three HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n2\r\n:d\r\n0\r\n\r\n" +
+		"GET /four HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+
+	reader := bufio.NewReader(client)
+	for _, want := range []string{"/one", "/two:abc", "/three:d", "/four"} {
+		statusLine, body := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+		assert.Equal(t, want, body)
+	}
+
+	_, err := reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHeaderInjection(t *testing.T) {
+	// Test: Decoded CRLF echoed into a header cannot forge fields
+	out := roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.FOUND)
+		h := response.GetDefaultHeaders(0)
+		h.Set("Location", req.QueryValue("next"))
+		w.WriteHeaders(h)
+	}, "GET /login?next=/home%0D%0ASet-Cookie:%20admin=1 HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	// the status line is out, so the connection is closed without headers
+	// rather than completing the redirect without its Location
+	assert.Equal(t, "HTTP/1.1 302 Found\r\n", out)
+
+	// Test: Control characters in request headers are a bad request
+	out = roundTrip(t, nil, "GET / HTTP/1.1\r\nX-Value: a\x01b\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 "))
+}
+
+func TestUnreadBody(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Target == "/close" {
+			w.SetConnectionClose()
+		}
+		w.WriteStatusLine(response.CONTENT_TOO_LARGE)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+
+	// Test: Body is not read when the connection closes anyway
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("POST /close HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10485760\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	statusLine, _ := readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\n", statusLine)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Large unread body closes the connection
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10485760\r\n\r\n"))
+	require.NoError(t, err)
+	reader = bufio.NewReader(conn)
+	statusLine, _ = readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\n", statusLine)
+	// the server may reset the connection while this is still being written
+	conn.Write(make([]byte, maxDrainBytes+4096))
+	_, err = reader.ReadByte()
+	assert.Error(t, err)
+	assert.False(t, isTimeout(err))
+}
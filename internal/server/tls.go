@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ListenAndServeTLS is like ListenAndServe but speaks HTTPS, using the
+// certificate and key from the given PEM files unless s.TLSConfig already
+// provides certificates.
+func (s *Server) ListenAndServeTLS(certFile string, keyFile string) error {
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+
+	list, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(list, certFile, keyFile)
+}
+
+// ServeTLS is like Serve but speaks HTTPS, using the certificate and key from
+// the given PEM files unless s.TLSConfig already provides certificates.
+func (s *Server) ServeTLS(list net.Listener, certFile string, keyFile string) error {
+	config := s.tlsConfig()
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			list.Close()
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return s.serveListener(tls.NewListener(list, config))
+}
+
+// tlsConfig returns a copy of s.TLSConfig advertising HTTP/1.1 over ALPN.
+func (s *Server) tlsConfig() *tls.Config {
+	var config *tls.Config
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config
+}
+
+// CertFiles names the PEM files of a certificate chain and its private key.
+type CertFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore serves certificates loaded from files, picking the one matching
+// the server name the client asked for through SNI. Reload re-reads the files,
+// so renewed certificates can be picked up without restarting the server.
+//
+// Use it as tls.Config.GetCertificate.
+type CertStore struct {
+	files []CertFiles
+
+	mu     sync.RWMutex
+	certs  []*tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+// LoadCertStore loads all given certificates. The first one is served to
+// clients that send no or an unknown server name.
+func LoadCertStore(files ...CertFiles) (*CertStore, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no certificates given")
+	}
+
+	cs := &CertStore{files: files}
+	if err := cs.Reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Reload re-reads all certificates. If any of them fails to load, the
+// previously loaded ones stay in use.
+func (cs *CertStore) Reload() error {
+	certs := make([]*tls.Certificate, 0, len(cs.files))
+	byName := map[string]*tls.Certificate{}
+
+	for _, f := range cs.files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", f.CertFile, err)
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", f.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, exists := byName[name]; !exists {
+				byName[name] = &cert
+			}
+		}
+		certs = append(certs, &cert)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.certs = certs
+	cs.byName = byName
+	return nil
+}
+
+// GetCertificate picks the certificate for the server name in hello, trying an
+// exact match first and a wildcard one for its parent domain second.
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := cs.byName[name]; ok {
+		return cert, nil
+	}
+	if _, parent, found := strings.Cut(name, "."); found {
+		if cert, ok := cs.byName["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+
+	return cs.certs[0], nil
+}
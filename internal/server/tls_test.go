@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"http-protocol-go/internal/request"
+	"http-protocol-go/internal/response"
+)
+
+// testCA signs certificates generated at test time.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue writes a certificate for commonName and dnsNames to PEM files in dir.
+func (ca *testCA) issue(t *testing.T, dir string, commonName string, dnsNames ...string) CertFiles {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := CertFiles{
+		CertFile: filepath.Join(dir, commonName+".crt"),
+		KeyFile:  filepath.Join(dir, commonName+".key"),
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	require.NoError(t, os.WriteFile(files.CertFile, certPem, 0o600))
+	require.NoError(t, os.WriteFile(files.KeyFile, keyPem, 0o600))
+	return files
+}
+
+func echoPeer(w *response.Writer, req *request.Request) {
+	body := "anonymous"
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		body = req.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody([]byte(body))
+}
+
+// tlsGet sends a request over TLS and returns the server certificate's common
+// name and the response body.
+func tlsGet(t *testing.T, addr string, config *tls.Config) (string, string) {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, config)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	_, body := readResponse(t, bufio.NewReader(conn))
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, body
+}
+
+func TestServeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	files := ca.issue(t, t.TempDir(), "localhost", "localhost")
+
+	s := &Server{Handler: echoPeer}
+	defer s.Close()
+
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(list, files.CertFile, files.KeyFile)
+
+	name, body := tlsGet(t, list.Addr().String(), &tls.Config{RootCAs: ca.pool, ServerName: "localhost"})
+	assert.Equal(t, "localhost", name)
+	assert.Equal(t, "anonymous", body)
+}
+
+func TestCertStore(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	defaultFiles := ca.issue(t, dir, "default", "default.test")
+	apiFiles := ca.issue(t, dir, "api", "api.example.test")
+	wildcardFiles := ca.issue(t, dir, "wildcard", "*.example.test")
+
+	store, err := LoadCertStore(defaultFiles, apiFiles, wildcardFiles)
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler: echoPeer,
+		TLSConfig: &tls.Config{
+			GetCertificate: store.GetCertificate,
+			ClientAuth:     tls.VerifyClientCertIfGiven,
+			ClientCAs:      ca.pool,
+		},
+	}
+	defer s.Close()
+
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(list)
+	addr := list.Addr().String()
+
+	// Test: Exact SNI match
+	name, _ := tlsGet(t, addr, &tls.Config{RootCAs: ca.pool, ServerName: "api.example.test"})
+	assert.Equal(t, "api", name)
+
+	// Test: Wildcard SNI match
+	name, _ = tlsGet(t, addr, &tls.Config{RootCAs: ca.pool, ServerName: "www.example.test"})
+	assert.Equal(t, "wildcard", name)
+
+	// Test: Unknown name falls back to the first certificate
+	name, _ = tlsGet(t, addr, &tls.Config{RootCAs: ca.pool, ServerName: "unknown.test", InsecureSkipVerify: true})
+	assert.Equal(t, "default", name)
+
+	// Test: Client certificate is exposed on the request
+	clientFiles := ca.issue(t, dir, "client")
+	clientCert, err := tls.LoadX509KeyPair(clientFiles.CertFile, clientFiles.KeyFile)
+	require.NoError(t, err)
+	_, body := tlsGet(t, addr, &tls.Config{
+		RootCAs:      ca.pool,
+		ServerName:   "api.example.test",
+		Certificates: []tls.Certificate{clientCert},
+	})
+	assert.Equal(t, "client", body)
+
+	// Test: Reload picks up renewed certificates
+	renewed := ca.issue(t, t.TempDir(), "api-renewed", "api.example.test")
+	require.NoError(t, os.Rename(renewed.CertFile, apiFiles.CertFile))
+	require.NoError(t, os.Rename(renewed.KeyFile, apiFiles.KeyFile))
+	require.NoError(t, store.Reload())
+	name, _ = tlsGet(t, addr, &tls.Config{RootCAs: ca.pool, ServerName: "api.example.test"})
+	assert.Equal(t, "api-renewed", name)
+
+	// Test: Failed reload keeps the current certificates
+	require.NoError(t, os.WriteFile(apiFiles.CertFile, []byte("garbage"), 0o600))
+	require.Error(t, store.Reload())
+	name, _ = tlsGet(t, addr, &tls.Config{RootCAs: ca.pool, ServerName: "api.example.test"})
+	assert.Equal(t, "api-renewed", name)
+}